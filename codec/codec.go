@@ -0,0 +1,58 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+
+	"github.com/shamaton/msgpack/v2"
+)
+
+// Codec serializes values leaving the process, e.g. to Redis or a snapshot
+// file.
+type Codec[V any] interface {
+	Marshal(value V) ([]byte, error)
+	Unmarshal(data []byte) (V, error)
+}
+
+type JSONCodec[V any] struct{}
+
+func (JSONCodec[V]) Marshal(value V) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (JSONCodec[V]) Unmarshal(data []byte) (V, error) {
+	var value V
+	err := json.Unmarshal(data, &value)
+	return value, err
+}
+
+// GobCodec keeps Go types that JSON loses, interface values must be
+// registered with gob.Register.
+type GobCodec[V any] struct{}
+
+func (GobCodec[V]) Marshal(value V) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(&value)
+	return buf.Bytes(), err
+}
+
+func (GobCodec[V]) Unmarshal(data []byte) (V, error) {
+	var value V
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+	return value, err
+}
+
+// MsgpackCodec is smaller and faster than JSON and keeps the same field
+// names.
+type MsgpackCodec[V any] struct{}
+
+func (MsgpackCodec[V]) Marshal(value V) ([]byte, error) {
+	return msgpack.Marshal(value)
+}
+
+func (MsgpackCodec[V]) Unmarshal(data []byte) (V, error) {
+	var value V
+	err := msgpack.Unmarshal(data, &value)
+	return value, err
+}
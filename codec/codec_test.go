@@ -0,0 +1,28 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	ID   int
+	Name string
+}
+
+func TestCodecs(t *testing.T) {
+	for name, c := range map[string]Codec[user]{
+		"json":    JSONCodec[user]{},
+		"gob":     GobCodec[user]{},
+		"msgpack": MsgpackCodec[user]{},
+	} {
+		t.Run(name, func(t *testing.T) {
+			data, err := c.Marshal(user{ID: 1, Name: "ann"})
+			assert.NoError(t, err)
+			value, err := c.Unmarshal(data)
+			assert.NoError(t, err)
+			assert.Equal(t, user{ID: 1, Name: "ann"}, value)
+		})
+	}
+}
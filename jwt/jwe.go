@@ -0,0 +1,292 @@
+package jwt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// Key management algorithms supported for JWE, content is always A256GCM.
+const (
+	AlgorithmDirect     = "dir"
+	AlgorithmRSAOAEP    = "RSA-OAEP"
+	AlgorithmRSAOAEP256 = "RSA-OAEP-256"
+
+	encA256GCM      = "A256GCM"
+	contentTypeJWT  = "JWT"
+	a256gcmKeyBytes = 32
+)
+
+var (
+	ErrMalformedJWE       = errors.New("jwe token is malformed")
+	ErrUnsupportedJWE     = errors.New("jwe algorithm is not supported")
+	ErrJWEDecrypt         = errors.New("jwe token cannot be decrypted")
+	ErrEncryptionRequired = errors.New("token is not encrypted")
+)
+
+// EncryptionConfig describes the JWE keys in yaml. DirectKey is the base64
+// encoded 32 byte key for "dir", the RSA keys are PEM encoded (PKIX/PKCS1
+// public, PKCS8/PKCS1 private). An issuer only needs the public key and a
+// verifier only the private key.
+type EncryptionConfig struct {
+	Algorithm     string `yaml:"algorithm"`
+	DirectKey     string `yaml:"direct_key"`
+	RSAPublicKey  string `yaml:"rsa_public_key"`
+	RSAPrivateKey string `yaml:"rsa_private_key"`
+}
+
+// Encryption produces and consumes compact JWE tokens.
+type Encryption struct {
+	algorithm  string
+	directKey  []byte
+	publicKey  *rsa.PublicKey
+	privateKey *rsa.PrivateKey
+}
+
+type jweHeader struct {
+	Algorithm   string `json:"alg"`
+	Encryption  string `json:"enc"`
+	ContentType string `json:"cty,omitempty"`
+}
+
+func NewDirectEncryption(key []byte) (*Encryption, error) {
+	if len(key) != a256gcmKeyBytes {
+		return nil, fmt.Errorf("dir key must be %d bytes, got %d", a256gcmKeyBytes, len(key))
+	}
+	return &Encryption{
+		algorithm: AlgorithmDirect,
+		directKey: key,
+	}, nil
+}
+
+// NewRSAEncryption wraps the content key with RSA-OAEP or RSA-OAEP-256.
+// Either key may be nil when only encryption or only decryption is needed.
+func NewRSAEncryption(algorithm string, publicKey *rsa.PublicKey, privateKey *rsa.PrivateKey) (*Encryption, error) {
+	if algorithm != AlgorithmRSAOAEP && algorithm != AlgorithmRSAOAEP256 {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedJWE, algorithm)
+	}
+	if publicKey == nil && privateKey != nil {
+		publicKey = &privateKey.PublicKey
+	}
+	if publicKey == nil {
+		return nil, errors.New("rsa encryption needs a public or private key")
+	}
+	return &Encryption{
+		algorithm:  algorithm,
+		publicKey:  publicKey,
+		privateKey: privateKey,
+	}, nil
+}
+
+func NewEncryption(config EncryptionConfig) (*Encryption, error) {
+	switch config.Algorithm {
+	case AlgorithmDirect:
+		key, err := base64.StdEncoding.DecodeString(config.DirectKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode dir key: %w", err)
+		}
+		return NewDirectEncryption(key)
+	case AlgorithmRSAOAEP, AlgorithmRSAOAEP256:
+		var publicKey *rsa.PublicKey
+		var privateKey *rsa.PrivateKey
+		var err error
+		if config.RSAPublicKey != "" {
+			publicKey, err = parseRSAPublicKey([]byte(config.RSAPublicKey))
+			if err != nil {
+				return nil, err
+			}
+		}
+		if config.RSAPrivateKey != "" {
+			privateKey, err = parseRSAPrivateKey([]byte(config.RSAPrivateKey))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return NewRSAEncryption(config.Algorithm, publicKey, privateKey)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedJWE, config.Algorithm)
+}
+
+// Encrypt returns the compact JWE of payload. contentType is set as the
+// "cty" header, "JWT" for a nested signed token.
+func (e *Encryption) Encrypt(payload []byte, contentType string) (string, error) {
+	header, err := json.Marshal(jweHeader{
+		Algorithm:   e.algorithm,
+		Encryption:  encA256GCM,
+		ContentType: contentType,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	cek, encryptedKey, err := e.contentKey()
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return "", err
+	}
+
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+
+	protected := base64.RawURLEncoding.EncodeToString(header)
+	sealed := gcm.Seal(nil, iv, payload, []byte(protected))
+	tagStart := len(sealed) - gcm.Overhead()
+
+	return strings.Join([]string{
+		protected,
+		base64.RawURLEncoding.EncodeToString(encryptedKey),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(sealed[:tagStart]),
+		base64.RawURLEncoding.EncodeToString(sealed[tagStart:]),
+	}, "."), nil
+}
+
+// Decrypt returns the payload of a compact JWE and its "cty" header.
+func (e *Encryption) Decrypt(token string) ([]byte, string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, "", ErrMalformedJWE
+	}
+
+	segments := make([][]byte, 5)
+	for i, part := range parts {
+		segment, err := base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			return nil, "", ErrMalformedJWE
+		}
+		segments[i] = segment
+	}
+
+	var header jweHeader
+	if err := json.Unmarshal(segments[0], &header); err != nil {
+		return nil, "", ErrMalformedJWE
+	}
+	// only accept the algorithm we are configured with, never the one the token asks for
+	if header.Algorithm != e.algorithm || header.Encryption != encA256GCM {
+		return nil, "", fmt.Errorf("%w: %s/%s", ErrUnsupportedJWE, header.Algorithm, header.Encryption)
+	}
+
+	cek, err := e.unwrapKey(segments[1])
+	if err != nil {
+		return nil, "", err
+	}
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(segments[2]) != gcm.NonceSize() || len(segments[4]) != gcm.Overhead() {
+		return nil, "", ErrMalformedJWE
+	}
+
+	sealed := append(segments[3], segments[4]...)
+	payload, err := gcm.Open(nil, segments[2], sealed, []byte(parts[0]))
+	if err != nil {
+		return nil, "", ErrJWEDecrypt
+	}
+	return payload, header.ContentType, nil
+}
+
+func (e *Encryption) contentKey() (cek []byte, encryptedKey []byte, err error) {
+	if e.algorithm == AlgorithmDirect {
+		return e.directKey, nil, nil
+	}
+
+	cek = make([]byte, a256gcmKeyBytes)
+	if _, err := rand.Read(cek); err != nil {
+		return nil, nil, err
+	}
+	encryptedKey, err = rsa.EncryptOAEP(e.oaepHash(), rand.Reader, e.publicKey, cek, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cek, encryptedKey, nil
+}
+
+func (e *Encryption) unwrapKey(encryptedKey []byte) ([]byte, error) {
+	if e.algorithm == AlgorithmDirect {
+		if len(encryptedKey) != 0 {
+			return nil, ErrMalformedJWE
+		}
+		return e.directKey, nil
+	}
+
+	if e.privateKey == nil {
+		return nil, errors.New("rsa private key is required to decrypt")
+	}
+	cek, err := rsa.DecryptOAEP(e.oaepHash(), nil, e.privateKey, encryptedKey, nil)
+	if err != nil || len(cek) != a256gcmKeyBytes {
+		return nil, ErrJWEDecrypt
+	}
+	return cek, nil
+}
+
+func (e *Encryption) oaepHash() hash.Hash {
+	if e.algorithm == AlgorithmRSAOAEP256 {
+		return sha256.New()
+	}
+	return sha1.New()
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func parseRSAPublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode rsa public key pem")
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rsa public key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an rsa key")
+	}
+	return rsaKey, nil
+}
+
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode rsa private key pem")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rsa private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an rsa key")
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,181 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newDirectKey(t *testing.T) []byte {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	assert.NoError(t, err)
+	return key
+}
+
+func TestDirectEncryption(t *testing.T) {
+	enc, err := NewDirectEncryption(newDirectKey(t))
+	assert.NoError(t, err)
+
+	t.Run("Round Trip", func(t *testing.T) {
+		token, err := enc.Encrypt([]byte(`{"phone":"13800000000"}`), "")
+		assert.NoError(t, err)
+		assert.Len(t, strings.Split(token, "."), 5, "Compact JWE should have 5 parts")
+		assert.NotContains(t, token, "13800000000")
+
+		payload, contentType, err := enc.Decrypt(token)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"phone":"13800000000"}`, string(payload))
+		assert.Empty(t, contentType)
+	})
+
+	t.Run("Wrong Key", func(t *testing.T) {
+		token, err := enc.Encrypt([]byte("secret"), "")
+		assert.NoError(t, err)
+
+		other, err := NewDirectEncryption(newDirectKey(t))
+		assert.NoError(t, err)
+		_, _, err = other.Decrypt(token)
+		assert.ErrorIs(t, err, ErrJWEDecrypt)
+	})
+
+	t.Run("Tampered Header", func(t *testing.T) {
+		token, err := enc.Encrypt([]byte("secret"), "")
+		assert.NoError(t, err)
+
+		parts := strings.Split(token, ".")
+		parts[0] = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"dir","enc":"A256GCM","cty":"JWT"}`))
+		_, _, err = enc.Decrypt(strings.Join(parts, "."))
+		assert.ErrorIs(t, err, ErrJWEDecrypt)
+	})
+
+	t.Run("Invalid Key Size", func(t *testing.T) {
+		_, err := NewDirectEncryption([]byte("short"))
+		assert.Error(t, err)
+	})
+}
+
+func TestRSAEncryption(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	for _, alg := range []string{AlgorithmRSAOAEP, AlgorithmRSAOAEP256} {
+		t.Run(alg, func(t *testing.T) {
+			encrypter, err := NewRSAEncryption(alg, &privateKey.PublicKey, nil)
+			assert.NoError(t, err)
+			decrypter, err := NewRSAEncryption(alg, nil, privateKey)
+			assert.NoError(t, err)
+
+			token, err := encrypter.Encrypt([]byte("tenant-42"), "")
+			assert.NoError(t, err)
+
+			payload, _, err := decrypter.Decrypt(token)
+			assert.NoError(t, err)
+			assert.Equal(t, "tenant-42", string(payload))
+
+			_, _, err = encrypter.Decrypt(token)
+			assert.Error(t, err, "Decrypt should fail without a private key")
+		})
+	}
+
+	t.Run("Algorithm Mismatch", func(t *testing.T) {
+		oaep, err := NewRSAEncryption(AlgorithmRSAOAEP, nil, privateKey)
+		assert.NoError(t, err)
+		oaep256, err := NewRSAEncryption(AlgorithmRSAOAEP256, nil, privateKey)
+		assert.NoError(t, err)
+
+		token, err := oaep.Encrypt([]byte("payload"), "")
+		assert.NoError(t, err)
+		_, _, err = oaep256.Decrypt(token)
+		assert.ErrorIs(t, err, ErrUnsupportedJWE)
+	})
+}
+
+func TestNewEncryption(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	assert.NoError(t, err)
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.NoError(t, err)
+
+	issuerEnc, err := NewEncryption(EncryptionConfig{
+		Algorithm:    AlgorithmRSAOAEP256,
+		RSAPublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+	})
+	assert.NoError(t, err)
+	verifierEnc, err := NewEncryption(EncryptionConfig{
+		Algorithm:     AlgorithmRSAOAEP256,
+		RSAPrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})),
+	})
+	assert.NoError(t, err)
+
+	token, err := issuerEnc.Encrypt([]byte("payload"), "")
+	assert.NoError(t, err)
+	payload, _, err := verifierEnc.Decrypt(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "payload", string(payload))
+
+	_, err = NewEncryption(EncryptionConfig{
+		Algorithm: AlgorithmDirect,
+		DirectKey: base64.StdEncoding.EncodeToString(newDirectKey(t)),
+	})
+	assert.NoError(t, err)
+
+	_, err = NewEncryption(EncryptionConfig{Algorithm: "A128KW"})
+	assert.ErrorIs(t, err, ErrUnsupportedJWE)
+}
+
+func TestNestedToken(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	encrypter, err := NewRSAEncryption(AlgorithmRSAOAEP256, &privateKey.PublicKey, nil)
+	assert.NoError(t, err)
+	decrypter, err := NewRSAEncryption(AlgorithmRSAOAEP256, nil, privateKey)
+	assert.NoError(t, err)
+
+	issuer := NewIssuer(testConfig, WithEncryption(encrypter))
+	verifier := NewVerifier(testConfig, WithEncryption(decrypter))
+
+	t.Run("Signed Then Encrypted", func(t *testing.T) {
+		token, err := issuer.GenerateToken(map[string]any{"phone": "13800000000"})
+		assert.NoError(t, err)
+		assert.Len(t, strings.Split(token, "."), 5)
+
+		claims, err := verifier.ValidateToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, "13800000000", claims["phone"])
+	})
+
+	t.Run("Plain JWS Rejected", func(t *testing.T) {
+		token, err := NewIssuer(testConfig).GenerateToken(map[string]any{"phone": "13800000000"})
+		assert.NoError(t, err)
+
+		_, err = verifier.ValidateToken(token)
+		assert.ErrorIs(t, err, ErrEncryptionRequired)
+	})
+
+	t.Run("Unsigned Payload Rejected", func(t *testing.T) {
+		// anyone with the public key can encrypt, so a bare claim set must not pass
+		token, err := encrypter.Encrypt([]byte(`{"phone":"13800000000"}`), "")
+		assert.NoError(t, err)
+
+		_, err = verifier.ValidateToken(token)
+		assert.True(t, errors.Is(err, ErrMalformedJWE))
+	})
+
+	t.Run("Wrong Signing Secret", func(t *testing.T) {
+		token, err := NewIssuer(JWTConfig{SecretKey: "other", ExpireMinute: 1}, WithEncryption(encrypter)).GenerateToken(map[string]any{})
+		assert.NoError(t, err)
+
+		_, err = verifier.ValidateToken(token)
+		assert.Error(t, err)
+	})
+}
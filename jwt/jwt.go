@@ -0,0 +1,153 @@
+package jwt
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type Option func(*options)
+
+type options struct {
+	now        func() time.Time
+	encryption *Encryption
+}
+
+// WithClock overrides time.Now, mainly for tests.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+// WithEncryption makes the Issuer wrap the signed token in a JWE and the
+// Verifier require such tokens.
+func WithEncryption(e *Encryption) Option {
+	return func(o *options) {
+		o.encryption = e
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{now: time.Now}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Issuer signs tokens with the secret of a single JWTConfig.
+type Issuer struct {
+	config     JWTConfig
+	now        func() time.Time
+	encryption *Encryption
+}
+
+func NewIssuer(config JWTConfig, opts ...Option) *Issuer {
+	o := newOptions(opts)
+	return &Issuer{
+		config:     config,
+		now:        o.now,
+		encryption: o.encryption,
+	}
+}
+
+func (i *Issuer) GenerateToken(claimMap map[string]any) (string, error) {
+	claims := jwt.MapClaims{}
+	for k, v := range claimMap {
+		claims[k] = v
+	}
+	expireTime := i.now().Add(time.Minute * time.Duration(i.config.ExpireMinute))
+	claims["exp"] = expireTime.Unix()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString([]byte(i.config.SecretKey))
+	if err != nil || i.encryption == nil {
+		return signed, err
+	}
+	return i.encryption.Encrypt([]byte(signed), contentTypeJWT)
+}
+
+// Verifier validates tokens signed with the secret of a single JWTConfig.
+type Verifier struct {
+	config     JWTConfig
+	now        func() time.Time
+	encryption *Encryption
+	parser     *jwt.Parser
+}
+
+func NewVerifier(config JWTConfig, opts ...Option) *Verifier {
+	o := newOptions(opts)
+	return &Verifier{
+		config:     config,
+		now:        o.now,
+		encryption: o.encryption,
+		// time based claims are checked against our own clock in validateClaims
+		parser: &jwt.Parser{SkipClaimsValidation: true},
+	}
+}
+
+func (v *Verifier) ValidateToken(token string) (map[string]any, error) {
+	if v.encryption != nil {
+		if strings.Count(token, ".") != 4 {
+			return nil, ErrEncryptionRequired
+		}
+		payload, contentType, err := v.encryption.Decrypt(token)
+		if err != nil {
+			return nil, err
+		}
+		// the payload must itself be signed, for RSA-OAEP anyone holding
+		// the public key could otherwise forge claims
+		if contentType != contentTypeJWT {
+			return nil, fmt.Errorf("%w: unexpected content type %q", ErrMalformedJWE, contentType)
+		}
+		token = string(payload)
+	}
+
+	claims := jwt.MapClaims{}
+
+	_, err := v.parser.ParseWithClaims(token, claims, func(token *jwt.Token) (any, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(v.config.SecretKey), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// validateClaims mirrors jwt.MapClaims.Valid but uses the verifier clock
+// instead of the package level jwt.TimeFunc.
+func (v *Verifier) validateClaims(claims jwt.MapClaims) error {
+	now := v.now().Unix()
+	vErr := new(jwt.ValidationError)
+
+	if !claims.VerifyExpiresAt(now, false) {
+		vErr.Inner = fmt.Errorf("Token is expired")
+		vErr.Errors |= jwt.ValidationErrorExpired
+	}
+
+	if !claims.VerifyIssuedAt(now, false) {
+		vErr.Inner = fmt.Errorf("Token used before issued")
+		vErr.Errors |= jwt.ValidationErrorIssuedAt
+	}
+
+	if !claims.VerifyNotBefore(now, false) {
+		vErr.Inner = fmt.Errorf("Token is not valid yet")
+		vErr.Errors |= jwt.ValidationErrorNotValidYet
+	}
+
+	if vErr.Errors == 0 {
+		return nil
+	}
+	return vErr
+}
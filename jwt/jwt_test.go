@@ -0,0 +1,90 @@
+package jwt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestIssuerVerifier(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	issuer := NewIssuer(testConfig, WithClock(clock.Now))
+	verifier := NewVerifier(testConfig, WithClock(clock.Now))
+
+	claims := map[string]any{"userID": 789}
+
+	t.Run("Expiry Uses Injected Clock", func(t *testing.T) {
+		token, err := issuer.GenerateToken(claims)
+		assert.NoError(t, err)
+
+		parsed, err := verifier.ValidateToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, float64(clock.now.Add(time.Minute).Unix()), parsed["exp"])
+		assert.NotContains(t, claims, "exp", "Caller claim map should not be modified")
+	})
+
+	t.Run("Expired After Clock Advance", func(t *testing.T) {
+		token, err := issuer.GenerateToken(claims)
+		assert.NoError(t, err)
+
+		clock.Advance(2 * time.Minute)
+		defer clock.Advance(-2 * time.Minute)
+
+		_, err = verifier.ValidateToken(token)
+		var ve *jwt.ValidationError
+		assert.True(t, errors.As(err, &ve), "Error should be a jwt.ValidationError")
+		if ve != nil {
+			assert.True(t, ve.Errors&jwt.ValidationErrorExpired != 0, "ValidationError should indicate token is expired")
+		}
+	})
+
+	t.Run("Not Yet Valid", func(t *testing.T) {
+		token, err := issuer.GenerateToken(map[string]any{"nbf": clock.now.Add(30 * time.Second).Unix()})
+		assert.NoError(t, err)
+
+		_, err = verifier.ValidateToken(token)
+		var ve *jwt.ValidationError
+		assert.True(t, errors.As(err, &ve), "Error should be a jwt.ValidationError")
+		if ve != nil {
+			assert.True(t, ve.Errors&jwt.ValidationErrorNotValidYet != 0, "ValidationError should indicate token is not valid yet")
+		}
+	})
+}
+
+func TestMultipleAudiences(t *testing.T) {
+	appConfig := JWTConfig{SecretKey: "app-secret", ExpireMinute: 10}
+	adminConfig := JWTConfig{SecretKey: "admin-secret", ExpireMinute: 5}
+
+	appToken, err := NewIssuer(appConfig).GenerateToken(map[string]any{"aud": "app"})
+	assert.NoError(t, err)
+	adminToken, err := NewIssuer(adminConfig).GenerateToken(map[string]any{"aud": "admin"})
+	assert.NoError(t, err)
+
+	appVerifier := NewVerifier(appConfig)
+	adminVerifier := NewVerifier(adminConfig)
+
+	_, err = appVerifier.ValidateToken(appToken)
+	assert.NoError(t, err)
+	_, err = adminVerifier.ValidateToken(adminToken)
+	assert.NoError(t, err)
+
+	_, err = appVerifier.ValidateToken(adminToken)
+	assert.Error(t, err, "Token signed for another audience should be rejected")
+	_, err = adminVerifier.ValidateToken(appToken)
+	assert.Error(t, err, "Token signed for another audience should be rejected")
+}
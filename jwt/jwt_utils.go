@@ -1,16 +1,13 @@
 package jwt
 
 import (
-	"fmt"
 	"sync"
-	"time"
-
-	"github.com/dgrijalva/jwt-go"
 )
 
 var (
-	gConfig JWTConfig
-	once    sync.Once
+	defaultIssuer   *Issuer
+	defaultVerifier *Verifier
+	once            sync.Once
 )
 
 type JWTConfig struct {
@@ -18,32 +15,35 @@ type JWTConfig struct {
 	ExpireMinute int    `yaml:"expire_minute"`
 }
 
+// InitJWT sets up the default Issuer and Verifier used by GenerateToken and
+// ValidateToken. Only the first call takes effect.
 func InitJWT(config JWTConfig) {
 	once.Do(func() {
-		gConfig = config
+		defaultIssuer = NewIssuer(config)
+		defaultVerifier = NewVerifier(config)
 	})
 }
 
 func GenerateToken(claimMap map[string]any) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims(claimMap))
-	expireTime := time.Now().Add(time.Minute * time.Duration(gConfig.ExpireMinute))
-	token.Claims.(jwt.MapClaims)["exp"] = expireTime.Unix()
-	return token.SignedString([]byte(gConfig.SecretKey))
+	return getDefaultIssuer().GenerateToken(claimMap)
 }
 
 func ValidateToken(token string) (map[string]any, error) {
-	claims := jwt.MapClaims{}
-
-	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(gConfig.SecretKey), nil
-	})
+	return getDefaultVerifier().ValidateToken(token)
+}
 
-	if err != nil {
-		return nil, err
+// before InitJWT the defaults behave like a zero JWTConfig, as the old
+// package globals did.
+func getDefaultIssuer() *Issuer {
+	if defaultIssuer == nil {
+		return NewIssuer(JWTConfig{})
 	}
+	return defaultIssuer
+}
 
-	return claims, nil
+func getDefaultVerifier() *Verifier {
+	if defaultVerifier == nil {
+		return NewVerifier(JWTConfig{})
+	}
+	return defaultVerifier
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -24,22 +25,22 @@ var testConfig = JWTConfig{
 
 // Helper function to reset global state for tests
 func resetGlobals() {
-	gConfig = JWTConfig{}
-	// Note: sync.Once cannot be reset easily. Tests assume InitJWT is called once per test run or rely on its idempotent nature.
-	// For more complex scenarios, dependency injection might be preferred over global state.
+	defaultIssuer = nil
+	defaultVerifier = nil
+	once = sync.Once{}
 }
 
 func TestInitJWT(t *testing.T) {
 	resetGlobals()
 	InitJWT(testConfig)
-	assert.Equal(t, testConfig.SecretKey, gConfig.SecretKey, "SecretKey should be initialized")
-	assert.Equal(t, testConfig.ExpireMinute, gConfig.ExpireMinute, "ExpireMinute should be initialized")
+	assert.Equal(t, testConfig, defaultIssuer.config, "Issuer config should be initialized")
+	assert.Equal(t, testConfig, defaultVerifier.config, "Verifier config should be initialized")
 
 	// Try initializing again with different config, should not change
 	anotherConfig := JWTConfig{SecretKey: "another-secret", ExpireMinute: 5}
 	InitJWT(anotherConfig)
-	assert.Equal(t, testConfig.SecretKey, gConfig.SecretKey, "SecretKey should not change after first init")
-	assert.Equal(t, testConfig.ExpireMinute, gConfig.ExpireMinute, "ExpireMinute should not change after first init")
+	assert.Equal(t, testConfig, defaultIssuer.config, "Issuer config should not change after first init")
+	assert.Equal(t, testConfig, defaultVerifier.config, "Verifier config should not change after first init")
 }
 
 func TestGenerateToken(t *testing.T) {
@@ -122,34 +123,31 @@ func TestValidateToken(t *testing.T) {
 	})
 
 	// --- Test Case 3: Invalid Signature ---
-	// This test is commented out because the current init use once.Do.
-	// It could pass if we remove the once.Do
-
-	// t.Run("InvalidSignature", func(t *testing.T) {
-	// 	// Generate token with correct secret
-	// 	token, err := GenerateToken(validClaims)
-	// 	assert.NoError(t, err)
-
-	// 	// Try validating with a wrong secret
-	// 	wrongSecretConfig := JWTConfig{SecretKey: "wrong-secret", ExpireMinute: testExpireMinute}
-	// 	resetGlobals()
-	// 	InitJWT(wrongSecretConfig) // Use wrong secret for validation attempt
-
-	// 	_, err = ValidateToken(token)
-	// 	assert.Error(t, err, "ValidateToken should return an error for invalid signature")
-	// 	// The specific error from jwt-go for signature mismatch is ValidationErrorSignatureInvalid
-	// 	var ve *jwt.ValidationError
-	// 	assert.True(t, errors.As(err, &ve), "Error should be a jwt.ValidationError")
-	// 	if ve != nil { // Add nil check for safety
-	// 		assert.True(t, ve.Errors&jwt.ValidationErrorSignatureInvalid != 0, "Error should indicate invalid signature")
-	// 	}
-
-	// 	// Reset back to original config
-	// 	resetGlobals()
-	// 	InitJWT(testConfig)
-	// })
-
-	// --- Test Case 3: Invalid Signing Method ---
+	t.Run("InvalidSignature", func(t *testing.T) {
+		// Generate token with correct secret
+		token, err := GenerateToken(validClaims)
+		assert.NoError(t, err)
+
+		// Try validating with a wrong secret
+		wrongSecretConfig := JWTConfig{SecretKey: "wrong-secret", ExpireMinute: testExpireMinute}
+		resetGlobals()
+		InitJWT(wrongSecretConfig) // Use wrong secret for validation attempt
+
+		_, err = ValidateToken(token)
+		assert.Error(t, err, "ValidateToken should return an error for invalid signature")
+		// The specific error from jwt-go for signature mismatch is ValidationErrorSignatureInvalid
+		var ve *jwt.ValidationError
+		assert.True(t, errors.As(err, &ve), "Error should be a jwt.ValidationError")
+		if ve != nil { // Add nil check for safety
+			assert.True(t, ve.Errors&jwt.ValidationErrorSignatureInvalid != 0, "Error should indicate invalid signature")
+		}
+
+		// Reset back to original config
+		resetGlobals()
+		InitJWT(testConfig)
+	})
+
+	// --- Test Case 4: Invalid Signing Method ---
 	t.Run("InvalidSigningMethod", func(t *testing.T) {
 		// Manually create a token with a different signing method (e.g., ES256) but sign with HS256 key
 		// This is tricky to do correctly without proper keys for ES256.
@@ -179,7 +177,7 @@ func TestValidateToken(t *testing.T) {
 		assert.Contains(t, err.Error(), "Unexpected signing method", "Error message should indicate unexpected signing method")
 	})
 
-	// --- Test Case 4: Malformed Token ---
+	// --- Test Case 5: Malformed Token ---
 	t.Run("MalformedToken", func(t *testing.T) {
 		malformedTokens := []string{
 			"invalidtoken",
@@ -195,7 +193,7 @@ func TestValidateToken(t *testing.T) {
 		}
 	})
 
-	// --- Test Case 5: Empty Token ---
+	// --- Test Case 6: Empty Token ---
 	t.Run("EmptyToken", func(t *testing.T) {
 		_, err := ValidateToken("")
 		assert.Error(t, err, "ValidateToken should return an error for an empty token string")
@@ -0,0 +1,259 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/dgdts/ts-gobase/i18n"
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	ClaimsContextKey = "jwt_claims"
+
+	langFuncContextKey = "jwt_lang_func"
+
+	defaultTokenLookup = "header:Authorization"
+	bearerPrefix       = "bearer "
+)
+
+// i18n message keys used in error responses, with the English fallback used
+// when the key is not configured through the i18n package.
+const (
+	MessageTokenMissing     = "jwt_token_missing"
+	MessageTokenInvalid     = "jwt_token_invalid"
+	MessageTokenExpired     = "jwt_token_expired"
+	MessagePermissionDenied = "jwt_permission_denied"
+)
+
+var defaultMessages = map[string]string{
+	MessageTokenMissing:     "authorization token is missing",
+	MessageTokenInvalid:     "authorization token is invalid",
+	MessageTokenExpired:     "authorization token is expired",
+	MessagePermissionDenied: "permission denied",
+}
+
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type MiddlewareOption func(*middlewareOptions)
+
+type middlewareOptions struct {
+	verifier    *Verifier
+	tokenLookup []string
+	langFunc    func(c *app.RequestContext) string
+}
+
+// WithVerifier validates tokens with v instead of the default Verifier set up
+// by InitJWT.
+func WithVerifier(v *Verifier) MiddlewareOption {
+	return func(o *middlewareOptions) {
+		o.verifier = v
+	}
+}
+
+// WithTokenLookup sets where the token is read from, tried in order.
+// Each entry is "header:<name>", "cookie:<name>" or "query:<name>".
+// Header values may carry a "Bearer " prefix.
+func WithTokenLookup(lookups ...string) MiddlewareOption {
+	return func(o *middlewareOptions) {
+		o.tokenLookup = lookups
+	}
+}
+
+// WithLangFunc sets how the language of error messages is resolved,
+// by default from the Accept-Language header.
+func WithLangFunc(f func(c *app.RequestContext) string) MiddlewareOption {
+	return func(o *middlewareOptions) {
+		o.langFunc = f
+	}
+}
+
+// Middleware authenticates the request with a bearer token and stores the
+// claims in the request context, see GetClaims.
+func Middleware(opts ...MiddlewareOption) app.HandlerFunc {
+	o := &middlewareOptions{
+		tokenLookup: []string{defaultTokenLookup},
+		langFunc:    acceptLanguage,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return func(ctx context.Context, c *app.RequestContext) {
+		token := o.extractToken(c)
+		if token == "" {
+			abort(c, http.StatusUnauthorized, MessageTokenMissing, o.langFunc(c))
+			return
+		}
+
+		verifier := o.verifier
+		if verifier == nil {
+			verifier = getDefaultVerifier()
+		}
+
+		claims, err := verifier.ValidateToken(token)
+		if err != nil {
+			abort(c, http.StatusUnauthorized, tokenErrorMessage(err), o.langFunc(c))
+			return
+		}
+
+		c.Set(ClaimsContextKey, claims)
+		c.Set(langFuncContextKey, o.langFunc)
+		c.Next(ctx)
+	}
+}
+
+type claimMatch int
+
+const (
+	matchAny claimMatch = iota
+	matchAll
+)
+
+// RequireRoles allows the request when the "roles" claim contains any of roles,
+// without roles it allows every authenticated request.
+// It must be placed after Middleware, whose WithLangFunc it follows.
+func RequireRoles(roles ...string) app.HandlerFunc {
+	return requireClaim("roles", roles, matchAny, requestLang)
+}
+
+// RequireScopes allows the request when the "scope" claim contains all of scopes,
+// without scopes it allows every authenticated request.
+// It must be placed after Middleware, whose WithLangFunc it follows.
+func RequireScopes(scopes ...string) app.HandlerFunc {
+	return requireClaim("scope", scopes, matchAll, requestLang)
+}
+
+func requireClaim(name string, want []string, match claimMatch, langFunc func(c *app.RequestContext) string) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		claims, ok := GetClaims(c)
+		if !ok {
+			abort(c, http.StatusUnauthorized, MessageTokenMissing, langFunc(c))
+			return
+		}
+		if len(want) == 0 {
+			c.Next(ctx)
+			return
+		}
+
+		have := make(map[string]struct{})
+		for _, v := range ClaimStrings(claims, name) {
+			have[v] = struct{}{}
+		}
+
+		matched := 0
+		for _, w := range want {
+			if _, ok := have[w]; ok {
+				matched++
+			}
+		}
+
+		if matched == 0 || (match == matchAll && matched != len(want)) {
+			abort(c, http.StatusForbidden, MessagePermissionDenied, langFunc(c))
+			return
+		}
+		c.Next(ctx)
+	}
+}
+
+func GetClaims(c *app.RequestContext) (map[string]any, bool) {
+	v, ok := c.Get(ClaimsContextKey)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := v.(map[string]any)
+	return claims, ok
+}
+
+// ClaimStrings reads a claim holding either a list of strings or a space
+// separated string, as used by the OAuth "scope" claim.
+func ClaimStrings(claims map[string]any, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return strings.Fields(v)
+	case []string:
+		return v
+	case []any:
+		ret := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				ret = append(ret, s)
+			}
+		}
+		return ret
+	}
+	return nil
+}
+
+func (o *middlewareOptions) extractToken(c *app.RequestContext) string {
+	for _, lookup := range o.tokenLookup {
+		source, name, ok := strings.Cut(lookup, ":")
+		if !ok {
+			continue
+		}
+
+		var token string
+		switch source {
+		case "header":
+			token = string(c.Request.Header.Peek(name))
+			if len(token) >= len(bearerPrefix) && strings.EqualFold(token[:len(bearerPrefix)], bearerPrefix) {
+				token = token[len(bearerPrefix):]
+			}
+		case "cookie":
+			token = string(c.Cookie(name))
+		case "query":
+			token = c.Query(name)
+		}
+
+		token = strings.TrimSpace(token)
+		if token != "" {
+			return token
+		}
+	}
+	return ""
+}
+
+func tokenErrorMessage(err error) string {
+	var ve *jwt.ValidationError
+	if errors.As(err, &ve) && ve.Errors&jwt.ValidationErrorExpired != 0 {
+		return MessageTokenExpired
+	}
+	return MessageTokenInvalid
+}
+
+func abort(c *app.RequestContext, status int, key string, lang string) {
+	message, err := i18n.GetLocalizeMessage(lang, key)
+	if err != nil || message == "" {
+		message = defaultMessages[key]
+	}
+	c.AbortWithStatusJSON(status, ErrorResponse{
+		Code:    key,
+		Message: message,
+	})
+}
+
+// requestLang resolves the language with the WithLangFunc of the Middleware
+// that authenticated the request.
+func requestLang(c *app.RequestContext) string {
+	if v, ok := c.Get(langFuncContextKey); ok {
+		if f, ok := v.(func(c *app.RequestContext) string); ok {
+			return f(c)
+		}
+	}
+	return acceptLanguage(c)
+}
+
+// acceptLanguage turns the first Accept-Language tag into the i18n key format,
+// e.g. "zh-CN,zh;q=0.9" -> "zh_CN".
+func acceptLanguage(c *app.RequestContext) string {
+	lang := string(c.Request.Header.Peek("Accept-Language"))
+	lang, _, _ = strings.Cut(lang, ",")
+	lang, _, _ = strings.Cut(lang, ";")
+	return strings.ReplaceAll(strings.TrimSpace(lang), "-", "_")
+}
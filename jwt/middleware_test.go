@@ -0,0 +1,158 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/dgdts/ts-gobase/i18n"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEngine(verifier *Verifier) *route.Engine {
+	engine := route.NewEngine(config.NewOptions(nil))
+	auth := engine.Group("/", Middleware(
+		WithVerifier(verifier),
+		WithTokenLookup("header:Authorization", "cookie:token", "query:token"),
+	))
+
+	ok := func(ctx context.Context, c *app.RequestContext) {
+		claims, _ := GetClaims(c)
+		c.JSON(http.StatusOK, claims)
+	}
+	auth.GET("/me", ok)
+	auth.GET("/admin", RequireRoles("admin"), ok)
+	auth.GET("/write", RequireScopes("read", "write"), ok)
+	return engine
+}
+
+func decodeError(t *testing.T, w *ut.ResponseRecorder) ErrorResponse {
+	var resp ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestMiddleware(t *testing.T) {
+	issuer := NewIssuer(testConfig)
+	engine := newTestEngine(NewVerifier(testConfig))
+
+	userToken, err := issuer.GenerateToken(map[string]any{"uid": 1, "roles": []string{"user"}, "scope": "read"})
+	assert.NoError(t, err)
+	adminToken, err := issuer.GenerateToken(map[string]any{"uid": 2, "roles": []string{"user", "admin"}, "scope": "read write"})
+	assert.NoError(t, err)
+
+	t.Run("Bearer Header", func(t *testing.T) {
+		w := ut.PerformRequest(engine, http.MethodGet, "/me", nil, ut.Header{Key: "Authorization", Value: "Bearer " + userToken})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var claims map[string]any
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &claims))
+		assert.Equal(t, float64(1), claims["uid"])
+	})
+
+	t.Run("Cookie", func(t *testing.T) {
+		w := ut.PerformRequest(engine, http.MethodGet, "/me", nil, ut.Header{Key: "Cookie", Value: "token=" + userToken})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Query", func(t *testing.T) {
+		w := ut.PerformRequest(engine, http.MethodGet, "/me?token="+userToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Missing Token", func(t *testing.T) {
+		w := ut.PerformRequest(engine, http.MethodGet, "/me", nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, MessageTokenMissing, decodeError(t, w).Code)
+	})
+
+	t.Run("Invalid Token", func(t *testing.T) {
+		w := ut.PerformRequest(engine, http.MethodGet, "/me", nil, ut.Header{Key: "Authorization", Value: "Bearer invalid"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, MessageTokenInvalid, decodeError(t, w).Code)
+	})
+
+	t.Run("Expired Token", func(t *testing.T) {
+		expired, err := NewIssuer(JWTConfig{SecretKey: testSecretKey, ExpireMinute: -5}).GenerateToken(map[string]any{"uid": 1})
+		assert.NoError(t, err)
+
+		w := ut.PerformRequest(engine, http.MethodGet, "/me", nil, ut.Header{Key: "Authorization", Value: "Bearer " + expired})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, MessageTokenExpired, decodeError(t, w).Code)
+	})
+
+	t.Run("Require Roles", func(t *testing.T) {
+		w := ut.PerformRequest(engine, http.MethodGet, "/admin", nil, ut.Header{Key: "Authorization", Value: "Bearer " + userToken})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, MessagePermissionDenied, decodeError(t, w).Code)
+
+		w = ut.PerformRequest(engine, http.MethodGet, "/admin", nil, ut.Header{Key: "Authorization", Value: "Bearer " + adminToken})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Require Scopes", func(t *testing.T) {
+		w := ut.PerformRequest(engine, http.MethodGet, "/write", nil, ut.Header{Key: "Authorization", Value: "Bearer " + userToken})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = ut.PerformRequest(engine, http.MethodGet, "/write", nil, ut.Header{Key: "Authorization", Value: "Bearer " + adminToken})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestRequireClaimOptions(t *testing.T) {
+	issuer := NewIssuer(testConfig)
+	engine := route.NewEngine(config.NewOptions(nil))
+	auth := engine.Group("/", Middleware(
+		WithVerifier(NewVerifier(testConfig)),
+		WithLangFunc(func(c *app.RequestContext) string { return "fixed" }),
+	))
+	ok := func(ctx context.Context, c *app.RequestContext) {
+		c.String(http.StatusOK, "ok")
+	}
+	auth.GET("/any-role", RequireRoles(), ok)
+	auth.GET("/any-scope", RequireScopes(), ok)
+	auth.GET("/admin", RequireRoles("admin"), ok)
+
+	var lang string
+	auth.GET("/lang", func(ctx context.Context, c *app.RequestContext) {
+		lang = requestLang(c)
+	})
+
+	token, err := issuer.GenerateToken(map[string]any{"uid": 1})
+	assert.NoError(t, err)
+	header := ut.Header{Key: "Authorization", Value: "Bearer " + token}
+
+	for _, path := range []string{"/any-role", "/any-scope"} {
+		w := ut.PerformRequest(engine, http.MethodGet, path, nil, header)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+	}
+
+	w := ut.PerformRequest(engine, http.MethodGet, "/admin", nil, header, ut.Header{Key: "Accept-Language", Value: "zh-CN"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	ut.PerformRequest(engine, http.MethodGet, "/lang", nil, header, ut.Header{Key: "Accept-Language", Value: "zh-CN"})
+	assert.Equal(t, "fixed", lang)
+}
+
+func TestMiddlewareI18n(t *testing.T) {
+	err := i18n.InitAndUpdateI18n(map[string]map[string]string{
+		MessageTokenMissing: {
+			"en_US": "Please sign in",
+			"zh_CN": "请先登录",
+		},
+	})
+	assert.NoError(t, err)
+
+	engine := newTestEngine(NewVerifier(testConfig))
+
+	w := ut.PerformRequest(engine, http.MethodGet, "/me", nil, ut.Header{Key: "Accept-Language", Value: "zh-CN,zh;q=0.9"})
+	assert.Equal(t, "请先登录", decodeError(t, w).Message)
+
+	w = ut.PerformRequest(engine, http.MethodGet, "/me", nil, ut.Header{Key: "Accept-Language", Value: "fr"})
+	assert.Equal(t, defaultMessages[MessageTokenMissing], decodeError(t, w).Message)
+}
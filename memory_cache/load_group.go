@@ -0,0 +1,48 @@
+package memory_cache
+
+import (
+	"errors"
+	"sync"
+)
+
+var errLoaderPanicked = errors.New("memory cache loader panicked")
+
+// loadGroup deduplicates concurrent loads of the same key, like
+// golang.org/x/sync/singleflight but keyed by K and typed by V.
+type loadGroup[K comparable, V any] struct {
+	mu    sync.Mutex
+	calls map[K]*loadCall[V]
+}
+
+type loadCall[V any] struct {
+	wg    sync.WaitGroup
+	value V
+	err   error
+}
+
+func (g *loadGroup[K, V]) do(key K, fn func() (V, error)) (V, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[K]*loadCall[V])
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.value, call.err
+	}
+	// reported to waiters if fn panics, the panic itself stays with the caller
+	call := &loadCall[V]{err: errLoaderPanicked}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		call.wg.Done()
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+	}()
+
+	call.value, call.err = fn()
+	return call.value, call.err
+}
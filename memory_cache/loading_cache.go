@@ -0,0 +1,241 @@
+package memory_cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+const (
+	defaultRefreshWorkers   = 4
+	defaultRefreshQueueSize = 1024
+	defaultLoadTimeout      = 30 * time.Second
+)
+
+// ErrLoadingCacheSnapshot is the panic of NewLoadingCache when SnapshotPath
+// is set, loaded entries are not written to snapshots.
+var ErrLoadingCacheSnapshot = errors.New("memory cache: loading cache does not support snapshot_path")
+
+// LoadingCacheConfig adds soft expiry to MemoryCacheConfig, whose
+// CacheTTLSeconds acts as the hard ttl. SnapshotPath must be empty.
+type LoadingCacheConfig struct {
+	MemoryCacheConfig  `yaml:",inline"`
+	SoftTTLSeconds     int `yaml:"soft_ttl_seconds"`     // after this the value is served stale and refreshed in background, 0 disables
+	NegativeTTLSeconds int `yaml:"negative_ttl_seconds"` // how long loader errors are cached, 0 disables
+	RefreshWorkers     int `yaml:"refresh_workers"`      // default 4
+	RefreshQueueSize   int `yaml:"refresh_queue_size"`   // default 1024, refreshes beyond it are dropped
+	LoadTimeoutSeconds int `yaml:"load_timeout_seconds"` // limit of a single load, default 30
+}
+
+// LoadingCache owns its loader. A miss blocks on a single shared load, an
+// entry older than the soft ttl is returned immediately while one background
+// worker reloads it, and an entry older than the hard ttl is gone.
+type LoadingCache[K comparable, V any] struct {
+	cache  *Cache[K, loadingEntry[V]]
+	config LoadingCacheConfig
+	loader func(ctx context.Context, key K) (V, error)
+
+	refreshing sync.Map // K -> struct{}
+	queue      chan K
+	wg         sync.WaitGroup
+	closeMutex sync.RWMutex
+	closed     bool
+	// cancelled by Close, stops refreshes in flight and drops queued ones
+	closeCtx    context.Context
+	cancelClose context.CancelFunc
+}
+
+type loadingEntry[V any] struct {
+	value        V
+	err          error
+	softExpireAt time.Time
+	hardExpireAt time.Time
+}
+
+func NewLoadingCache[K comparable, V any](config *LoadingCacheConfig, loader func(ctx context.Context, key K) (V, error), opts ...Option) *LoadingCache[K, V] {
+	if config.SnapshotPath != "" {
+		panic(ErrLoadingCacheSnapshot)
+	}
+	lc := &LoadingCache[K, V]{
+		cache:  NewCache[K, loadingEntry[V]](&config.MemoryCacheConfig, opts...),
+		config: *config,
+		loader: loader,
+	}
+	if lc.config.RefreshWorkers <= 0 {
+		lc.config.RefreshWorkers = defaultRefreshWorkers
+	}
+	if lc.config.RefreshQueueSize <= 0 {
+		lc.config.RefreshQueueSize = defaultRefreshQueueSize
+	}
+	if lc.config.LoadTimeoutSeconds <= 0 {
+		lc.config.LoadTimeoutSeconds = int(defaultLoadTimeout / time.Second)
+	}
+
+	lc.closeCtx, lc.cancelClose = context.WithCancel(context.Background())
+	lc.queue = make(chan K, lc.config.RefreshQueueSize)
+	for i := 0; i < lc.config.RefreshWorkers; i++ {
+		lc.wg.Add(1)
+		go lc.refreshWorker()
+	}
+	return lc
+}
+
+// Get returns the cached value of key, loading it on a miss. A cached loader
+// error is returned as is until NegativeTTLSeconds passes. The shared load
+// keeps the values of ctx but not its cancellation, so one caller giving up
+// does not fail the others.
+func (lc *LoadingCache[K, V]) Get(ctx context.Context, key K) (V, error) {
+	if entry, ok := lc.cache.Get(key); ok {
+		if time.Now().After(entry.softExpireAt) {
+			lc.scheduleRefresh(key)
+		}
+		return entry.value, entry.err
+	}
+
+	entry, err := lc.cache.loadGroup.do(key, func() (loadingEntry[V], error) {
+		if entry, ok := lc.cache.getQuietly(key); ok {
+			return entry, nil
+		}
+		return lc.load(ctx, key), nil
+	})
+	if err != nil {
+		// the loader panicked in the caller that ran it
+		var zero V
+		return zero, err
+	}
+	return entry.value, entry.err
+}
+
+// Set stores value as freshly loaded.
+func (lc *LoadingCache[K, V]) Set(key K, value V) {
+	lc.store(key, loadingEntry[V]{value: value})
+}
+
+func (lc *LoadingCache[K, V]) Delete(key K) {
+	lc.cache.Delete(key)
+}
+
+func (lc *LoadingCache[K, V]) Stats() Stats {
+	return lc.cache.Stats()
+}
+
+// Close stops the refresh workers, queued refreshes are dropped and the ones
+// in flight are cancelled.
+func (lc *LoadingCache[K, V]) Close() {
+	lc.closeMutex.Lock()
+	if lc.closed {
+		lc.closeMutex.Unlock()
+		return
+	}
+	lc.closed = true
+	lc.cancelClose()
+	close(lc.queue)
+	lc.closeMutex.Unlock()
+
+	lc.wg.Wait()
+	lc.cache.Close()
+}
+
+// callLoader runs the loader limited by LoadTimeoutSeconds.
+func (lc *LoadingCache[K, V]) callLoader(ctx context.Context, key K) (V, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(lc.config.LoadTimeoutSeconds)*time.Second)
+	defer cancel()
+	return lc.loader(ctx, key)
+}
+
+// isContextErr tells errors of a cancelled or timed out load, which say
+// nothing about the key and are not cached.
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func (lc *LoadingCache[K, V]) load(ctx context.Context, key K) loadingEntry[V] {
+	lc.cache.stats.loads.Add(1)
+	// the load is shared, one caller giving up must not fail the others
+	value, err := lc.callLoader(context.WithoutCancel(ctx), key)
+	if err != nil {
+		lc.cache.stats.loadErrors.Add(1)
+		entry := loadingEntry[V]{err: err}
+		if lc.config.NegativeTTLSeconds > 0 && !isContextErr(err) {
+			ttl := time.Duration(lc.config.NegativeTTLSeconds) * time.Second
+			now := time.Now()
+			entry.softExpireAt = now.Add(ttl)
+			entry.hardExpireAt = now.Add(ttl)
+			lc.cache.SetWithTTL(key, entry, ttl)
+		}
+		return entry
+	}
+	return lc.store(key, loadingEntry[V]{value: value})
+}
+
+func (lc *LoadingCache[K, V]) store(key K, entry loadingEntry[V]) loadingEntry[V] {
+	now := time.Now()
+	hardTTL := lc.cache.defaultTTL()
+	softTTL := time.Duration(lc.config.SoftTTLSeconds) * time.Second
+	if softTTL <= 0 || softTTL > hardTTL {
+		softTTL = hardTTL
+	}
+	entry.softExpireAt = now.Add(softTTL)
+	entry.hardExpireAt = now.Add(hardTTL)
+	lc.cache.SetWithTTL(key, entry, hardTTL)
+	return entry
+}
+
+// scheduleRefresh queues at most one background reload per key.
+func (lc *LoadingCache[K, V]) scheduleRefresh(key K) {
+	if _, loaded := lc.refreshing.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+
+	lc.closeMutex.RLock()
+	defer lc.closeMutex.RUnlock()
+	if lc.closed {
+		return
+	}
+	select {
+	case lc.queue <- key:
+	default:
+		// the stale value keeps being served, a later Get retries
+		lc.refreshing.Delete(key)
+	}
+}
+
+func (lc *LoadingCache[K, V]) refreshWorker() {
+	defer lc.wg.Done()
+	for key := range lc.queue {
+		if lc.closeCtx.Err() == nil {
+			lc.refresh(key)
+		}
+		lc.refreshing.Delete(key)
+	}
+}
+
+func (lc *LoadingCache[K, V]) refresh(key K) {
+	lc.cache.stats.loads.Add(1)
+	value, err := lc.callLoader(lc.closeCtx, key)
+	if err == nil {
+		// the key may have been deleted while loading
+		if _, ok := lc.cache.getQuietly(key); ok {
+			lc.store(key, loadingEntry[V]{value: value})
+		}
+		return
+	}
+
+	lc.cache.stats.loadErrors.Add(1)
+	hlog.Warnf("memory cache refresh %v failed: %v", key, err)
+
+	// keep serving the stale value, but do not retry before the negative ttl
+	entry, ok := lc.cache.getQuietly(key)
+	if !ok || lc.config.NegativeTTLSeconds <= 0 || isContextErr(err) {
+		return
+	}
+	remaining := time.Until(entry.hardExpireAt)
+	if remaining <= 0 {
+		return
+	}
+	entry.softExpireAt = time.Now().Add(time.Duration(lc.config.NegativeTTLSeconds) * time.Second)
+	lc.cache.SetWithTTL(key, entry, remaining)
+}
@@ -0,0 +1,270 @@
+package memory_cache
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadingCache_StaleWhileRevalidate(t *testing.T) {
+	var version atomic.Int32
+	release := make(chan struct{}, 10)
+	loader := func(ctx context.Context, key string) (int32, error) {
+		v := version.Add(1)
+		if v > 1 {
+			<-release
+		}
+		return v, nil
+	}
+
+	cache := NewLoadingCache(&LoadingCacheConfig{
+		MemoryCacheConfig: testConfig,
+		SoftTTLSeconds:    1,
+	}, loader)
+	defer cache.Close()
+
+	ctx := context.Background()
+	v, err := cache.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), v)
+
+	time.Sleep(1100 * time.Millisecond)
+
+	// past the soft ttl every caller gets the stale value at once
+	for i := 0; i < 5; i++ {
+		v, err = cache.Get(ctx, "key")
+		assert.NoError(t, err)
+		assert.Equal(t, int32(1), v)
+	}
+
+	release <- struct{}{}
+	assert.Eventually(t, func() bool {
+		v, _ := cache.Get(ctx, "key")
+		return v == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), version.Load(), "Only one refresh should run for a key")
+}
+
+func TestLoadingCache_Stampede(t *testing.T) {
+	var calls atomic.Int32
+	loader := func(ctx context.Context, key string) (string, error) {
+		calls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		return "value", nil
+	}
+
+	cache := NewLoadingCache(&LoadingCacheConfig{MemoryCacheConfig: testConfig}, loader)
+	defer cache.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := cache.Get(context.Background(), "key")
+			assert.NoError(t, err)
+			assert.Equal(t, "value", v)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestLoadingCache_NegativeCaching(t *testing.T) {
+	loadErr := errors.New("not found")
+	var calls atomic.Int32
+	loader := func(ctx context.Context, key string) (string, error) {
+		calls.Add(1)
+		return "", loadErr
+	}
+
+	cache := NewLoadingCache(&LoadingCacheConfig{
+		MemoryCacheConfig:  testConfig,
+		NegativeTTLSeconds: 1,
+	}, loader)
+	defer cache.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_, err := cache.Get(ctx, "key")
+		assert.ErrorIs(t, err, loadErr)
+	}
+	assert.Equal(t, int32(1), calls.Load(), "Errors should be cached for the negative ttl")
+
+	time.Sleep(2100 * time.Millisecond)
+	_, err := cache.Get(ctx, "key")
+	assert.ErrorIs(t, err, loadErr)
+	assert.Equal(t, int32(2), calls.Load(), "Loader should be retried after the negative ttl")
+}
+
+func TestLoadingCache_CancelledCaller(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context, key string) (string, error) {
+		calls.Add(1)
+		<-release
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		return "value", nil
+	}
+
+	cache := NewLoadingCache(&LoadingCacheConfig{
+		MemoryCacheConfig:  testConfig,
+		NegativeTTLSeconds: 60,
+	}, loader)
+	defer cache.Close()
+
+	// the first caller gives up while the shared load runs
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		value, err := cache.Get(ctx, "key")
+		assert.NoError(t, err)
+		assert.Equal(t, "value", value)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	close(release)
+	<-done
+
+	value, err := cache.Get(context.Background(), "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", value)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestLoadingCache_ContextErrorsNotCached(t *testing.T) {
+	var calls atomic.Int32
+	loader := func(ctx context.Context, key string) (string, error) {
+		if calls.Add(1) == 1 {
+			return "", context.DeadlineExceeded
+		}
+		return "value", nil
+	}
+
+	cache := NewLoadingCache(&LoadingCacheConfig{
+		MemoryCacheConfig:  testConfig,
+		NegativeTTLSeconds: 60,
+	}, loader)
+	defer cache.Close()
+
+	ctx := context.Background()
+	_, err := cache.Get(ctx, "key")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	value, err := cache.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", value)
+}
+
+func TestLoadingCache_LoaderPanic(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var calls atomic.Int32
+	loader := func(ctx context.Context, key string) (int, error) {
+		if calls.Add(1) > 1 {
+			return 1, nil
+		}
+		close(started)
+		<-release
+		panic("loader bug")
+	}
+
+	cache := NewLoadingCache(&LoadingCacheConfig{MemoryCacheConfig: testConfig}, loader)
+	defer cache.Close()
+
+	go func() {
+		defer func() { _ = recover() }()
+		_, _ = cache.Get(context.Background(), "key")
+	}()
+	<-started
+
+	waiter := make(chan error, 1)
+	go func() {
+		_, err := cache.Get(context.Background(), "key")
+		waiter <- err
+	}()
+	// let the waiter join the running load
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	assert.ErrorIs(t, <-waiter, errLoaderPanicked)
+}
+
+func TestLoadingCache_CloseDropsRefreshes(t *testing.T) {
+	var loads atomic.Int32
+	loader := func(ctx context.Context, key int) (int, error) {
+		loads.Add(1)
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(time.Second):
+			return key, nil
+		}
+	}
+
+	cache := NewLoadingCache(&LoadingCacheConfig{
+		MemoryCacheConfig: testConfig,
+		RefreshWorkers:    1,
+	}, loader)
+	for i := 0; i < 20; i++ {
+		cache.Set(i, i)
+		cache.scheduleRefresh(i)
+	}
+	assert.Eventually(t, func() bool { return loads.Load() == 1 }, time.Second, 5*time.Millisecond)
+
+	start := time.Now()
+	cache.Close()
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, int32(1), loads.Load(), "Queued refreshes should be dropped")
+}
+
+func TestLoadingCache_RejectsSnapshot(t *testing.T) {
+	config := LoadingCacheConfig{MemoryCacheConfig: testConfig}
+	config.SnapshotPath = filepath.Join(t.TempDir(), "loading.snapshot")
+	assert.PanicsWithValue(t, ErrLoadingCacheSnapshot, func() {
+		NewLoadingCache(&config, func(ctx context.Context, key string) (int, error) { return 0, nil })
+	})
+}
+
+func TestLoadingCache_RefreshFailureKeepsStale(t *testing.T) {
+	var fail atomic.Bool
+	loader := func(ctx context.Context, key string) (string, error) {
+		if fail.Load() {
+			return "", errors.New("backend down")
+		}
+		return "value", nil
+	}
+
+	cache := NewLoadingCache(&LoadingCacheConfig{
+		MemoryCacheConfig:  testConfig,
+		SoftTTLSeconds:     1,
+		NegativeTTLSeconds: 5,
+	}, loader)
+	defer cache.Close()
+
+	ctx := context.Background()
+	_, err := cache.Get(ctx, "key")
+	assert.NoError(t, err)
+
+	fail.Store(true)
+	time.Sleep(1100 * time.Millisecond)
+
+	v, err := cache.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", v)
+
+	assert.Eventually(t, func() bool {
+		return cache.Stats().LoadErrors == 1
+	}, time.Second, 10*time.Millisecond)
+
+	v, err = cache.Get(ctx, "key")
+	assert.NoError(t, err, "Failed refresh should keep serving the stale value")
+	assert.Equal(t, "value", v)
+}
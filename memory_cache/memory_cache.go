@@ -1,56 +1,333 @@
 package memory_cache
 
 import (
+	"fmt"
+	"reflect"
+	"sync"
 	"time"
 
+	"github.com/dgdts/ts-gobase/atomic_buffer"
+	"github.com/dgdts/ts-gobase/codec"
 	"github.com/maypok86/otter"
 )
 
+// how long a replaced otter cache stays open for calls that loaded it before
+// Reconfigure swapped it out
+const reconfigureCloseDelay = 10 * time.Second
+
 type MemoryCacheConfig struct {
 	CacheCount      int  `yaml:"cache_count"`
 	CacheTTLSeconds int  `yaml:"cache_ttl_seconds"`
 	CacheEnable     bool `yaml:"cache_enable"`
+
+	// optional warm start, both are read once when the cache is created
+	SnapshotPath            string `yaml:"snapshot_path"`             // loaded on creation and saved on Close
+	SnapshotIntervalSeconds int    `yaml:"snapshot_interval_seconds"` // also save periodically when > 0
+}
+
+type Option func(*options)
+
+type options struct {
+	name          string
+	snapshotCodec any // codec.Codec[V]
+}
+
+// WithName registers the cache stats under name for GetStats and
+// WritePrometheus.
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// Cache is a typed in-memory cache. When CacheEnable is false every call is a
+// no-op and GetOrLoad always calls the loader.
+type Cache[K comparable, V any] struct {
+	state            *atomic_buffer.AtomicBuffer[*cacheState[K, V]]
+	reconfigureMutex sync.Mutex
+	loadGroup        loadGroup[K, V]
+	name             string
+	stats            statsCounter
+	tags             tagIndex[K]
+	writeMutex       sync.RWMutex // Set and Delete share it, invalidations take it alone
+
+	snapshotCodec   codec.Codec[V]
+	snapshotDone    chan struct{}
+	snapshotStopped chan struct{}
+	closeOnce       sync.Once
+
+	listenersMutex sync.RWMutex
+	listeners      []func(key K, value V, cause DeletionCause)
 }
 
-type MemoryCache struct {
-	memoryCache       *otter.Cache[string, any]
+// cacheState is swapped as a whole by Reconfigure.
+type cacheState[K comparable, V any] struct {
+	memoryCache       *otter.CacheWithVariableTTL[K, V] // nil when disabled
 	memoryCacheConfig MemoryCacheConfig
 }
 
-func NewMemoryCache(config *MemoryCacheConfig) *MemoryCache {
-	ret := &MemoryCache{}
+func (st *cacheState[K, V]) enabled() bool {
+	return st.memoryCache != nil
+}
 
-	ret.memoryCacheConfig = *config
+// MemoryCache is kept for callers written before Cache was generic.
+type MemoryCache = Cache[string, any]
 
-	if !ret.memoryCacheConfig.CacheEnable {
-		return ret
+func NewCache[K comparable, V any](config *MemoryCacheConfig, opts ...Option) *Cache[K, V] {
+	o := options{snapshotCodec: codec.GobCodec[V]{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	snapshotCodec, ok := o.snapshotCodec.(codec.Codec[V])
+	if !ok {
+		panic(fmt.Sprintf("memory cache snapshot codec %T does not encode %s", o.snapshotCodec, reflect.TypeFor[V]()))
 	}
-	builder := otter.MustBuilder[string, any](ret.memoryCacheConfig.CacheCount).WithTTL(time.Duration(ret.memoryCacheConfig.CacheTTLSeconds) * time.Second)
-	cache, err := builder.Build()
+
+	ret := &Cache[K, V]{}
+
+	ret.name = o.name
+	ret.snapshotCodec = snapshotCodec
+
+	state, err := ret.newState(config)
 	if err != nil {
 		panic(err)
 	}
-	ret.memoryCache = &cache
+	ret.state = atomic_buffer.NewAtomicBuffer(state)
+	ret.warmStart()
+
+	if ret.name != "" {
+		registerStats(ret.name, ret)
+	}
 	return ret
 }
 
-func (mc *MemoryCache) Get(key string) (any, bool) {
-	if !mc.memoryCacheConfig.CacheEnable {
-		return nil, false
+func (mc *Cache[K, V]) newState(config *MemoryCacheConfig) (*cacheState[K, V], error) {
+	state := &cacheState[K, V]{memoryCacheConfig: *config}
+	if !config.CacheEnable {
+		return state, nil
+	}
+	if config.CacheTTLSeconds <= 0 {
+		return nil, otter.ErrIllegalTTL
+	}
+	builder, err := otter.NewBuilder[K, V](config.CacheCount)
+	if err != nil {
+		return nil, err
+	}
+	cache, err := builder.WithVariableTTL().DeletionListener(func(key K, value V, cause otter.DeletionCause) {
+		// a cache replaced by Reconfigure keeps expiring the entries that were
+		// copied to its successor until it is closed
+		if mc.state.Load().memoryCache != state.memoryCache {
+			return
+		}
+		mc.onDeletion(key, value, cause)
+	}).Build()
+	if err != nil {
+		return nil, err
+	}
+	state.memoryCache = &cache
+	return state, nil
+}
+
+func NewMemoryCache(config *MemoryCacheConfig, opts ...Option) *MemoryCache {
+	return NewCache[string, any](config, opts...)
+}
+
+func (mc *Cache[K, V]) Get(key K) (V, bool) {
+	st := mc.state.Load()
+	if !st.enabled() {
+		var zero V
+		return zero, false
+	}
+	value, ok := st.memoryCache.Get(key)
+	if ok {
+		mc.stats.hits.Add(1)
+	} else {
+		mc.stats.misses.Add(1)
 	}
-	return mc.memoryCache.Get(key)
+	return value, ok
+}
+
+func (mc *Cache[K, V]) Set(key K, value V) {
+	mc.SetWithTTL(key, value, mc.defaultTTL())
 }
 
-func (mc *MemoryCache) Set(key string, value any) {
-	if !mc.memoryCacheConfig.CacheEnable {
+// SetWithTTL overrides CacheTTLSeconds for a single entry. TTLs are rounded
+// up to whole seconds.
+func (mc *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	mc.writeMutex.RLock()
+	defer mc.writeMutex.RUnlock()
+
+	st := mc.state.Load()
+	if !st.enabled() {
 		return
 	}
-	mc.memoryCache.Set(key, value)
+	mc.tags.set(key, nil)
+	st.memoryCache.Set(key, value, ttl)
 }
 
-func (mc *MemoryCache) Delete(key string) {
-	if !mc.memoryCacheConfig.CacheEnable {
+func (mc *Cache[K, V]) Delete(key K) {
+	mc.writeMutex.RLock()
+	defer mc.writeMutex.RUnlock()
+
+	st := mc.state.Load()
+	if !st.enabled() {
 		return
 	}
-	mc.memoryCache.Delete(key)
+	mc.tags.remove(key)
+	st.memoryCache.Delete(key)
+}
+
+// GetOrLoad returns the cached value of key, or calls loader and caches its
+// result. Concurrent misses on the same key share a single loader call.
+// Loader errors are returned to every waiter and are not cached.
+func (mc *Cache[K, V]) GetOrLoad(key K, loader func(key K) (V, error)) (V, error) {
+	if value, ok := mc.Get(key); ok {
+		return value, nil
+	}
+
+	return mc.loadGroup.do(key, func() (V, error) {
+		// another caller may have filled the entry while we waited for the lock
+		if value, ok := mc.getQuietly(key); ok {
+			return value, nil
+		}
+		mc.stats.loads.Add(1)
+		value, err := loader(key)
+		if err != nil {
+			mc.stats.loadErrors.Add(1)
+			return value, err
+		}
+		mc.Set(key, value)
+		return value, nil
+	})
+}
+
+// OnDeletion adds a listener called whenever an entry leaves the cache.
+// Listeners run on the cache maintenance path, they should return quickly and
+// must not write to the cache.
+func (mc *Cache[K, V]) OnDeletion(listener func(key K, value V, cause DeletionCause)) {
+	mc.listenersMutex.Lock()
+	defer mc.listenersMutex.Unlock()
+	mc.listeners = append(mc.listeners, listener)
+}
+
+func (mc *Cache[K, V]) Stats() Stats {
+	stats := mc.stats.snapshot()
+	st := mc.state.Load()
+	if st.enabled() {
+		stats.Size = st.memoryCache.Size()
+		stats.Capacity = st.memoryCache.Capacity()
+	}
+	return stats
+}
+
+func (mc *Cache[K, V]) Config() MemoryCacheConfig {
+	return mc.state.Load().memoryCacheConfig
+}
+
+// Reconfigure applies a new config at runtime. Entries survive a change of
+// CacheCount or CacheTTLSeconds, with their remaining ttl capped to the new
+// CacheTTLSeconds, and are dropped when the cache gets disabled.
+func (mc *Cache[K, V]) Reconfigure(config *MemoryCacheConfig) error {
+	mc.reconfigureMutex.Lock()
+	defer mc.reconfigureMutex.Unlock()
+
+	old := mc.state.Load()
+	if old.memoryCacheConfig == *config {
+		return nil
+	}
+
+	// a ttl change alone only affects the next Set, unless it shortens the ttl
+	if old.enabled() && config.CacheEnable && config.CacheTTLSeconds > 0 &&
+		config.CacheCount == old.memoryCacheConfig.CacheCount &&
+		config.CacheTTLSeconds >= old.memoryCacheConfig.CacheTTLSeconds {
+		mc.state.Store(&cacheState[K, V]{
+			memoryCache:       old.memoryCache,
+			memoryCacheConfig: *config,
+		})
+		return nil
+	}
+
+	state, err := mc.newState(config)
+	if err != nil {
+		return err
+	}
+
+	// writes and invalidations wait for the copy, or the copy could bring
+	// back entries they removed
+	mc.writeMutex.Lock()
+	defer mc.writeMutex.Unlock()
+	mc.state.Store(state)
+
+	if !old.enabled() {
+		return nil
+	}
+	if !state.enabled() {
+		mc.tags.clear()
+	} else {
+		maxTTL := time.Duration(config.CacheTTLSeconds) * time.Second
+		old.memoryCache.Range(func(key K, value V) bool {
+			entry, ok := old.memoryCache.Extension().GetEntryQuietly(key)
+			if !ok || entry.HasExpired() {
+				// the replaced cache no longer reports it, drop its tags here
+				if _, ok := state.memoryCache.Extension().GetQuietly(key); !ok {
+					mc.tags.remove(key)
+				}
+				return true
+			}
+			ttl := min(entry.TTL(), maxTTL)
+			// writes that already reached the new cache win over the copy
+			state.memoryCache.SetIfAbsent(key, value, ttl)
+			return true
+		})
+	}
+	time.AfterFunc(reconfigureCloseDelay, old.memoryCache.Close)
+	return nil
+}
+
+// Close writes the final snapshot if SnapshotPath is set, releases the cache
+// and removes it from the stats registry.
+func (mc *Cache[K, V]) Close() {
+	mc.closeOnce.Do(func() {
+		mc.stopSnapshot()
+		if mc.name != "" {
+			unregisterStats(mc.name, mc)
+		}
+		st := mc.state.Load()
+		if st.enabled() {
+			st.memoryCache.Close()
+		}
+	})
+}
+
+// getQuietly reads an entry without counting a hit or miss.
+func (mc *Cache[K, V]) getQuietly(key K) (V, bool) {
+	st := mc.state.Load()
+	if !st.enabled() {
+		var zero V
+		return zero, false
+	}
+	return st.memoryCache.Extension().GetQuietly(key)
+}
+
+func (mc *Cache[K, V]) onDeletion(key K, value V, otterCause otter.DeletionCause) {
+	cause := deletionCauseFromOtter(otterCause)
+	mc.stats.recordDeletion(cause)
+
+	// Set and Delete keep the tag index in sync themselves, evictions arrive
+	// later and the key may have been set again meanwhile
+	if cause == CauseSize || cause == CauseExpired {
+		if _, ok := mc.getQuietly(key); !ok {
+			mc.tags.remove(key)
+		}
+	}
+
+	mc.listenersMutex.RLock()
+	defer mc.listenersMutex.RUnlock()
+	for _, listener := range mc.listeners {
+		listener(key, value, cause)
+	}
+}
+
+func (mc *Cache[K, V]) defaultTTL() time.Duration {
+	return time.Duration(mc.state.Load().memoryCacheConfig.CacheTTLSeconds) * time.Second
 }
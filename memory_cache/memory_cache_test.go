@@ -0,0 +1,158 @@
+package memory_cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testConfig = MemoryCacheConfig{
+	CacheCount:      100,
+	CacheTTLSeconds: 60,
+	CacheEnable:     true,
+}
+
+func TestCache_Typed(t *testing.T) {
+	type user struct {
+		Name string
+	}
+	cache := NewCache[int64, *user](&testConfig)
+
+	cache.Set(1, &user{Name: "alice"})
+	u, ok := cache.Get(1)
+	assert.True(t, ok)
+	assert.Equal(t, "alice", u.Name)
+
+	cache.Delete(1)
+	_, ok = cache.Get(1)
+	assert.False(t, ok)
+}
+
+func TestCache_SetWithTTL(t *testing.T) {
+	cache := NewCache[string, string](&testConfig)
+
+	cache.SetWithTTL("short", "value", time.Second)
+	cache.Set("long", "value")
+
+	time.Sleep(2100 * time.Millisecond)
+
+	_, ok := cache.Get("short")
+	assert.False(t, ok, "Entry with a TTL override should expire")
+	_, ok = cache.Get("long")
+	assert.True(t, ok, "Entry with the default TTL should still be cached")
+}
+
+func TestCache_Disabled(t *testing.T) {
+	cache := NewCache[string, int](&MemoryCacheConfig{CacheEnable: false})
+
+	cache.Set("a", 1)
+	_, ok := cache.Get("a")
+	assert.False(t, ok)
+
+	calls := 0
+	for i := 0; i < 2; i++ {
+		v, err := cache.GetOrLoad("a", func(string) (int, error) {
+			calls++
+			return 1, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, v)
+	}
+	assert.Equal(t, 2, calls, "Disabled cache should call the loader every time")
+}
+
+func TestCache_GetOrLoad(t *testing.T) {
+	t.Run("Concurrent Misses Load Once", func(t *testing.T) {
+		cache := NewCache[string, int](&testConfig)
+
+		var calls atomic.Int32
+		release := make(chan struct{})
+		loader := func(string) (int, error) {
+			calls.Add(1)
+			<-release
+			return 42, nil
+		}
+
+		var wg sync.WaitGroup
+		results := make([]int, 10)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				v, err := cache.GetOrLoad("key", loader)
+				assert.NoError(t, err)
+				results[i] = v
+			}(i)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, int32(1), calls.Load())
+		for _, v := range results {
+			assert.Equal(t, 42, v)
+		}
+
+		v, ok := cache.Get("key")
+		assert.True(t, ok)
+		assert.Equal(t, 42, v)
+	})
+
+	t.Run("Errors Are Not Cached", func(t *testing.T) {
+		cache := NewCache[string, int](&testConfig)
+		loadErr := errors.New("load failed")
+
+		_, err := cache.GetOrLoad("key", func(string) (int, error) {
+			return 0, loadErr
+		})
+		assert.ErrorIs(t, err, loadErr)
+
+		v, err := cache.GetOrLoad("key", func(string) (int, error) {
+			return 7, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 7, v)
+	})
+}
+
+func TestCache_ReconfigureDetachesOldCache(t *testing.T) {
+	config := testConfig
+	cache := NewCache[string, int](&config)
+
+	var mutex sync.Mutex
+	var causes []DeletionCause
+	cache.OnDeletion(func(key string, value int, cause DeletionCause) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		causes = append(causes, cause)
+	})
+
+	cache.SetWithTTL("a", 1, time.Second)
+	config.CacheCount *= 2
+	assert.NoError(t, cache.Reconfigure(&config))
+	cache.SetWithTTL("a", 2, time.Minute)
+
+	// the copy left in the replaced cache expires unseen
+	time.Sleep(2500 * time.Millisecond)
+	v, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, int64(0), cache.Stats().Expirations)
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.NotContains(t, causes, CauseExpired)
+}
+
+func TestMemoryCache_Compatible(t *testing.T) {
+	var cache *MemoryCache = NewMemoryCache(&testConfig)
+
+	cache.Set("a", 1)
+	v, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v.(int))
+}
@@ -0,0 +1,91 @@
+package memory_cache
+
+import (
+	"fmt"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+type memoryCacheManager struct {
+	mutex  sync.RWMutex
+	caches map[string]*MemoryCache
+}
+
+var memoryCacheManagerInstance = &memoryCacheManager{
+	caches: make(map[string]*MemoryCache),
+}
+
+// InitAndUpdateMemoryCacheWithYaml is InitAndUpdateMemoryCache for a yaml map
+// of cache name to MemoryCacheConfig.
+func InitAndUpdateMemoryCacheWithYaml(rawYamlData []byte) error {
+	configs := make(map[string]*MemoryCacheConfig)
+	if err := yaml.Unmarshal(rawYamlData, &configs); err != nil {
+		return err
+	}
+	return InitAndUpdateMemoryCache(configs)
+}
+
+// InitAndUpdateMemoryCache creates the named caches on the first call. Later
+// calls reconfigure caches whose config changed in place, see Reconfigure,
+// create new names and disable names that are gone, so pointers returned by
+// GetMemoryCache stay valid.
+func InitAndUpdateMemoryCache(configs map[string]*MemoryCacheConfig) error {
+	return memoryCacheManagerInstance.update(configs)
+}
+
+// GetMemoryCache returns the cache configured under name, or nil.
+func GetMemoryCache(name string) *MemoryCache {
+	return memoryCacheManagerInstance.get(name)
+}
+
+func MustGetMemoryCache(name string) *MemoryCache {
+	cache := GetMemoryCache(name)
+	if cache == nil {
+		panic("cannot get memory cache name:" + name)
+	}
+	return cache
+}
+
+func (m *memoryCacheManager) update(configs map[string]*MemoryCacheConfig) error {
+	for name, config := range configs {
+		if config == nil {
+			return fmt.Errorf("memory cache %s has no config", name)
+		}
+		if config.CacheEnable && (config.CacheCount <= 0 || config.CacheTTLSeconds <= 0) {
+			return fmt.Errorf("memory cache %s needs positive cache_count and cache_ttl_seconds", name)
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for name, config := range configs {
+		cache, ok := m.caches[name]
+		if !ok {
+			m.caches[name] = NewMemoryCache(config, WithName(name))
+			continue
+		}
+		if err := cache.Reconfigure(config); err != nil {
+			return fmt.Errorf("reconfigure memory cache %s failed: %w", name, err)
+		}
+	}
+
+	for name, cache := range m.caches {
+		if _, ok := configs[name]; ok {
+			continue
+		}
+		disabled := cache.Config()
+		disabled.CacheEnable = false
+		if err := cache.Reconfigure(&disabled); err != nil {
+			return fmt.Errorf("disable memory cache %s failed: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (m *memoryCacheManager) get(name string) *MemoryCache {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.caches[name]
+}
@@ -0,0 +1,92 @@
+package memory_cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	err := InitAndUpdateMemoryCacheWithYaml([]byte(`
+users:
+  cache_count: 100
+  cache_ttl_seconds: 60
+  cache_enable: true
+orders:
+  cache_count: 100
+  cache_ttl_seconds: 60
+  cache_enable: true
+`))
+	assert.NoError(t, err)
+
+	users := MustGetMemoryCache("users")
+	orders := MustGetMemoryCache("orders")
+	users.Set("u1", "alice")
+	orders.Set("o1", 100)
+
+	t.Run("Resize Keeps Entries", func(t *testing.T) {
+		err := InitAndUpdateMemoryCache(map[string]*MemoryCacheConfig{
+			"users":  {CacheCount: 200, CacheTTLSeconds: 30, CacheEnable: true},
+			"orders": {CacheCount: 100, CacheTTLSeconds: 60, CacheEnable: true},
+		})
+		assert.NoError(t, err)
+
+		assert.Same(t, users, MustGetMemoryCache("users"), "Reconfigure should keep the same cache")
+		assert.Equal(t, 200, users.Stats().Capacity)
+		assert.Equal(t, 30, users.Config().CacheTTLSeconds)
+
+		v, ok := users.Get("u1")
+		assert.True(t, ok)
+		assert.Equal(t, "alice", v)
+
+		v, ok = orders.Get("o1")
+		assert.True(t, ok, "Unchanged cache should keep its entries")
+		assert.Equal(t, 100, v)
+	})
+
+	t.Run("Disable And Enable", func(t *testing.T) {
+		err := InitAndUpdateMemoryCache(map[string]*MemoryCacheConfig{
+			"users":  {CacheCount: 200, CacheTTLSeconds: 30, CacheEnable: false},
+			"orders": {CacheCount: 100, CacheTTLSeconds: 60, CacheEnable: true},
+		})
+		assert.NoError(t, err)
+
+		_, ok := users.Get("u1")
+		assert.False(t, ok)
+		users.Set("u2", "bob")
+		_, ok = users.Get("u2")
+		assert.False(t, ok, "Disabled cache should not store")
+
+		err = InitAndUpdateMemoryCache(map[string]*MemoryCacheConfig{
+			"users":  {CacheCount: 200, CacheTTLSeconds: 30, CacheEnable: true},
+			"orders": {CacheCount: 100, CacheTTLSeconds: 60, CacheEnable: true},
+		})
+		assert.NoError(t, err)
+
+		users.Set("u2", "bob")
+		_, ok = users.Get("u2")
+		assert.True(t, ok)
+	})
+
+	t.Run("Removed Name Is Disabled", func(t *testing.T) {
+		err := InitAndUpdateMemoryCache(map[string]*MemoryCacheConfig{
+			"users": {CacheCount: 200, CacheTTLSeconds: 30, CacheEnable: true},
+		})
+		assert.NoError(t, err)
+
+		assert.False(t, orders.Config().CacheEnable)
+		_, ok := orders.Get("o1")
+		assert.False(t, ok)
+	})
+
+	t.Run("Invalid Config", func(t *testing.T) {
+		err := InitAndUpdateMemoryCache(map[string]*MemoryCacheConfig{
+			"users": {CacheCount: 0, CacheTTLSeconds: 30, CacheEnable: true},
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 200, users.Stats().Capacity, "Invalid config should not be applied")
+	})
+
+	assert.Nil(t, GetMemoryCache("unknown"))
+	assert.Panics(t, func() { MustGetMemoryCache("unknown") })
+}
@@ -0,0 +1,204 @@
+package memory_cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/dgdts/ts-gobase/codec"
+)
+
+// snapshot file layout: magic | crc32 of payload | payload
+var snapshotMagic = []byte("MCS1")
+
+var ErrCorruptSnapshot = errors.New("memory cache snapshot is corrupt")
+
+// WithSnapshotCodec encodes the values of SnapshotPath with c instead of
+// codec.GobCodec, V must be the value type of the cache.
+func WithSnapshotCodec[V any](c codec.Codec[V]) Option {
+	return func(o *options) {
+		o.snapshotCodec = c
+	}
+}
+
+// the snapshot itself is gob, values are encoded by the snapshot codec
+type snapshot[K comparable] struct {
+	Entries []snapshotEntry[K]
+}
+
+type snapshotEntry[K comparable] struct {
+	Key      K
+	Value    []byte
+	ExpireAt int64 // unix seconds
+	Tags     []string
+}
+
+// SaveSnapshot writes every live entry and its remaining ttl to SnapshotPath.
+// The file is replaced atomically.
+func (mc *Cache[K, V]) SaveSnapshot() error {
+	st := mc.state.Load()
+	path := st.memoryCacheConfig.SnapshotPath
+	if !st.enabled() || path == "" {
+		return nil
+	}
+
+	snap := snapshot[K]{Entries: make([]snapshotEntry[K], 0, st.memoryCache.Size())}
+	extension := st.memoryCache.Extension()
+	var err error
+	st.memoryCache.Range(func(key K, value V) bool {
+		entry, ok := extension.GetEntryQuietly(key)
+		if !ok || entry.HasExpired() {
+			return true
+		}
+		var data []byte
+		if data, err = mc.snapshotCodec.Marshal(value); err != nil {
+			return false
+		}
+		snap.Entries = append(snap.Entries, snapshotEntry[K]{
+			Key:      key,
+			Value:    data,
+			ExpireAt: entry.Expiration(),
+			Tags:     mc.tags.get(key),
+		})
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("encode memory cache snapshot failed: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&snap); err != nil {
+		return fmt.Errorf("encode memory cache snapshot failed: %w", err)
+	}
+	payload := buf.Bytes()
+
+	data := make([]byte, 0, len(snapshotMagic)+4+len(payload))
+	data = append(data, snapshotMagic...)
+	data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(payload))
+	data = append(data, payload...)
+
+	return writeFileAtomic(path, data)
+}
+
+// LoadSnapshot adds the entries of SnapshotPath that have not expired yet.
+// A missing file is not an error, a corrupt one returns ErrCorruptSnapshot
+// and loads nothing.
+func (mc *Cache[K, V]) LoadSnapshot() error {
+	st := mc.state.Load()
+	path := st.memoryCacheConfig.SnapshotPath
+	if !st.enabled() || path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	header := len(snapshotMagic) + 4
+	if len(data) < header || !bytes.Equal(data[:len(snapshotMagic)], snapshotMagic) {
+		return ErrCorruptSnapshot
+	}
+	payload := data[header:]
+	if binary.BigEndian.Uint32(data[len(snapshotMagic):header]) != crc32.ChecksumIEEE(payload) {
+		return ErrCorruptSnapshot
+	}
+
+	var snap snapshot[K]
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&snap); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+	}
+	values := make([]V, len(snap.Entries))
+	for i, entry := range snap.Entries {
+		if values[i], err = mc.snapshotCodec.Unmarshal(entry.Value); err != nil {
+			return fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+		}
+	}
+
+	now := time.Now().Unix()
+	maxTTL := mc.defaultTTL()
+	for i, entry := range snap.Entries {
+		if entry.ExpireAt <= now {
+			continue
+		}
+		ttl := min(time.Duration(entry.ExpireAt-now)*time.Second, maxTTL)
+		mc.SetWithTTLAndTags(entry.Key, values[i], ttl, entry.Tags...)
+	}
+	return nil
+}
+
+// warmStart loads the snapshot on construction and keeps saving it every
+// SnapshotIntervalSeconds until Close.
+func (mc *Cache[K, V]) warmStart() {
+	config := mc.state.Load().memoryCacheConfig
+	if config.SnapshotPath == "" {
+		return
+	}
+
+	if err := mc.LoadSnapshot(); err != nil {
+		hlog.Warnf("memory cache load snapshot %s failed, starting empty: %v", config.SnapshotPath, err)
+	}
+
+	if config.SnapshotIntervalSeconds <= 0 {
+		return
+	}
+	mc.snapshotDone = make(chan struct{})
+	mc.snapshotStopped = make(chan struct{})
+	go func() {
+		defer close(mc.snapshotStopped)
+		ticker := time.NewTicker(time.Duration(config.SnapshotIntervalSeconds) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-mc.snapshotDone:
+				return
+			case <-ticker.C:
+				if err := mc.SaveSnapshot(); err != nil {
+					hlog.Warnf("memory cache save snapshot %s failed: %v", config.SnapshotPath, err)
+				}
+			}
+		}
+	}()
+}
+
+// stopSnapshot stops the periodic snapshot and writes a last one.
+func (mc *Cache[K, V]) stopSnapshot() {
+	if mc.snapshotDone != nil {
+		close(mc.snapshotDone)
+		<-mc.snapshotStopped
+	}
+	if err := mc.SaveSnapshot(); err != nil {
+		hlog.Warnf("memory cache save snapshot failed: %v", err)
+	}
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
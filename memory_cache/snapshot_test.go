@@ -0,0 +1,103 @@
+package memory_cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgdts/ts-gobase/codec"
+	"github.com/stretchr/testify/assert"
+)
+
+func snapshotConfig(path string) *MemoryCacheConfig {
+	return &MemoryCacheConfig{
+		CacheCount:      100,
+		CacheTTLSeconds: 60,
+		CacheEnable:     true,
+		SnapshotPath:    path,
+	}
+}
+
+func TestSnapshot_WarmStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.snapshot")
+
+	for _, valueCodec := range []codec.Codec[profile]{codec.GobCodec[profile]{}, codec.JSONCodec[profile]{}, codec.MsgpackCodec[profile]{}} {
+		cache := NewCache[string, profile](snapshotConfig(path), WithSnapshotCodec(valueCodec))
+		cache.Set("1", profile{Name: "alice", Age: 20})
+		cache.SetWithTags("2", profile{Name: "bob"}, "tenant:a")
+		cache.SetWithTTL("3", profile{Name: "carol"}, time.Second)
+		cache.Close()
+
+		time.Sleep(1100 * time.Millisecond)
+
+		warm := NewCache[string, profile](snapshotConfig(path), WithSnapshotCodec(valueCodec))
+
+		v, ok := warm.Get("1")
+		assert.True(t, ok)
+		assert.Equal(t, profile{Name: "alice", Age: 20}, v)
+
+		_, ok = warm.Get("3")
+		assert.False(t, ok, "Expired entries should be discarded")
+
+		assert.Equal(t, 1, warm.InvalidateTag("tenant:a"), "Tags should survive a snapshot")
+		warm.Close()
+	}
+}
+
+func TestSnapshot_CodecType(t *testing.T) {
+	assert.Panics(t, func() {
+		NewCache[string, profile](&testConfig, WithSnapshotCodec(codec.JSONCodec[int]{}))
+	})
+}
+
+func TestSnapshot_Periodic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.snapshot")
+	config := snapshotConfig(path)
+	config.SnapshotIntervalSeconds = 1
+
+	cache := NewCache[string, int](config)
+	defer cache.Close()
+	cache.Set("a", 1)
+
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}, 3*time.Second, 50*time.Millisecond)
+}
+
+func TestSnapshot_Corrupt(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("Missing File", func(t *testing.T) {
+		cache := NewCache[string, int](snapshotConfig(filepath.Join(dir, "missing.snapshot")))
+		assert.NoError(t, cache.LoadSnapshot())
+	})
+
+	t.Run("Garbage", func(t *testing.T) {
+		path := filepath.Join(dir, "garbage.snapshot")
+		assert.NoError(t, os.WriteFile(path, []byte("not a snapshot"), 0o644))
+
+		cache := NewCache[string, int](snapshotConfig(path))
+		assert.ErrorIs(t, cache.LoadSnapshot(), ErrCorruptSnapshot)
+		assert.Equal(t, 0, cache.Stats().Size)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		path := filepath.Join(dir, "truncated.snapshot")
+		cache := NewCache[string, int](snapshotConfig(path))
+		for i := 0; i < 10; i++ {
+			cache.Set(string(rune('a'+i)), i)
+		}
+		assert.NoError(t, cache.SaveSnapshot())
+
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(path, data[:len(data)-5], 0o644))
+
+		warm := NewCache[string, int](snapshotConfig(path))
+		assert.ErrorIs(t, warm.LoadSnapshot(), ErrCorruptSnapshot)
+		_, ok := warm.Get("a")
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,190 @@
+package memory_cache
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/maypok86/otter"
+)
+
+// DeletionCause tells why an entry left the cache.
+type DeletionCause int
+
+const (
+	CauseExplicit DeletionCause = iota // removed by Delete
+	CauseReplaced                      // overwritten by Set
+	CauseSize                          // evicted because the cache was full
+	CauseExpired                       // ttl passed
+)
+
+func (c DeletionCause) String() string {
+	switch c {
+	case CauseExplicit:
+		return "explicit"
+	case CauseReplaced:
+		return "replaced"
+	case CauseSize:
+		return "size"
+	case CauseExpired:
+		return "expired"
+	}
+	return "unknown"
+}
+
+func deletionCauseFromOtter(cause otter.DeletionCause) DeletionCause {
+	switch cause {
+	case otter.Replaced:
+		return CauseReplaced
+	case otter.Size:
+		return CauseSize
+	case otter.Expired:
+		return CauseExpired
+	}
+	return CauseExplicit
+}
+
+// Stats is a point in time copy of the cache counters.
+type Stats struct {
+	Hits        int64
+	Misses      int64
+	Loads       int64
+	LoadErrors  int64
+	Evictions   int64 // CauseSize
+	Expirations int64 // CauseExpired
+	Deletions   int64 // CauseExplicit
+	Size        int
+	Capacity    int
+}
+
+// Ratio is hits / (hits + misses), 0 before the first lookup.
+func (s Stats) Ratio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+type statsCounter struct {
+	hits        atomic.Int64
+	misses      atomic.Int64
+	loads       atomic.Int64
+	loadErrors  atomic.Int64
+	evictions   atomic.Int64
+	expirations atomic.Int64
+	deletions   atomic.Int64
+}
+
+func (s *statsCounter) recordDeletion(cause DeletionCause) {
+	switch cause {
+	case CauseSize:
+		s.evictions.Add(1)
+	case CauseExpired:
+		s.expirations.Add(1)
+	case CauseExplicit:
+		s.deletions.Add(1)
+	}
+}
+
+func (s *statsCounter) snapshot() Stats {
+	return Stats{
+		Hits:        s.hits.Load(),
+		Misses:      s.misses.Load(),
+		Loads:       s.loads.Load(),
+		LoadErrors:  s.loadErrors.Load(),
+		Evictions:   s.evictions.Load(),
+		Expirations: s.expirations.Load(),
+		Deletions:   s.deletions.Load(),
+	}
+}
+
+type statsProvider interface {
+	Stats() Stats
+}
+
+// named caches, exported by WritePrometheus
+var (
+	statsRegistry      = make(map[string]statsProvider)
+	statsRegistryMutex sync.RWMutex
+)
+
+func registerStats(name string, provider statsProvider) {
+	statsRegistryMutex.Lock()
+	defer statsRegistryMutex.Unlock()
+	statsRegistry[name] = provider
+}
+
+func unregisterStats(name string, provider statsProvider) {
+	statsRegistryMutex.Lock()
+	defer statsRegistryMutex.Unlock()
+	if statsRegistry[name] == provider {
+		delete(statsRegistry, name)
+	}
+}
+
+// GetStats returns the stats of the cache created WithName(name).
+func GetStats(name string) (Stats, bool) {
+	statsRegistryMutex.RLock()
+	provider, ok := statsRegistry[name]
+	statsRegistryMutex.RUnlock()
+	if !ok {
+		return Stats{}, false
+	}
+	return provider.Stats(), true
+}
+
+type prometheusMetric struct {
+	name  string
+	help  string
+	kind  string
+	value func(s Stats) float64
+	label string // extra label, e.g. cause="size"
+}
+
+var prometheusMetrics = []prometheusMetric{
+	{name: "memory_cache_hits_total", help: "Number of lookups that found an entry.", kind: "counter", value: func(s Stats) float64 { return float64(s.Hits) }},
+	{name: "memory_cache_misses_total", help: "Number of lookups that found no entry.", kind: "counter", value: func(s Stats) float64 { return float64(s.Misses) }},
+	{name: "memory_cache_hit_ratio", help: "Hits divided by lookups.", kind: "gauge", value: func(s Stats) float64 { return s.Ratio() }},
+	{name: "memory_cache_loads_total", help: "Number of loader calls.", kind: "counter", value: func(s Stats) float64 { return float64(s.Loads) }},
+	{name: "memory_cache_load_errors_total", help: "Number of loader calls that returned an error.", kind: "counter", value: func(s Stats) float64 { return float64(s.LoadErrors) }},
+	{name: "memory_cache_deletions_total", help: "Number of entries removed, by cause.", kind: "counter", label: `cause="size"`, value: func(s Stats) float64 { return float64(s.Evictions) }},
+	{name: "memory_cache_deletions_total", label: `cause="expired"`, value: func(s Stats) float64 { return float64(s.Expirations) }},
+	{name: "memory_cache_deletions_total", label: `cause="explicit"`, value: func(s Stats) float64 { return float64(s.Deletions) }},
+	{name: "memory_cache_entries", help: "Number of entries currently cached.", kind: "gauge", value: func(s Stats) float64 { return float64(s.Size) }},
+	{name: "memory_cache_capacity", help: "Maximum number of entries.", kind: "gauge", value: func(s Stats) float64 { return float64(s.Capacity) }},
+}
+
+// WritePrometheus writes the stats of every named cache in the Prometheus
+// text exposition format, labelled with cache="<name>".
+func WritePrometheus(w io.Writer) error {
+	statsRegistryMutex.RLock()
+	names := make([]string, 0, len(statsRegistry))
+	stats := make(map[string]Stats, len(statsRegistry))
+	for name, provider := range statsRegistry {
+		names = append(names, name)
+		stats[name] = provider.Stats()
+	}
+	statsRegistryMutex.RUnlock()
+	sort.Strings(names)
+
+	for _, metric := range prometheusMetrics {
+		if metric.help != "" {
+			if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", metric.name, metric.help, metric.name, metric.kind); err != nil {
+				return err
+			}
+		}
+		for _, name := range names {
+			labels := fmt.Sprintf("cache=%q", name)
+			if metric.label != "" {
+				labels += "," + metric.label
+			}
+			if _, err := fmt.Fprintf(w, "%s{%s} %v\n", metric.name, labels, metric.value(stats[name])); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
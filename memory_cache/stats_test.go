@@ -0,0 +1,92 @@
+package memory_cache
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_Stats(t *testing.T) {
+	cache := NewCache[string, int](&testConfig)
+
+	cache.Set("a", 1)
+	cache.Get("a")
+	cache.Get("a")
+	cache.Get("b")
+
+	_, _ = cache.GetOrLoad("c", func(string) (int, error) { return 3, nil })
+	_, _ = cache.GetOrLoad("d", func(string) (int, error) { return 0, errors.New("load failed") })
+
+	stats := cache.Stats()
+	assert.Equal(t, int64(2), stats.Hits)
+	assert.Equal(t, int64(3), stats.Misses)
+	assert.Equal(t, int64(2), stats.Loads)
+	assert.Equal(t, int64(1), stats.LoadErrors)
+	assert.InDelta(t, 0.4, stats.Ratio(), 0.0001)
+	assert.Equal(t, 2, stats.Size)
+}
+
+func TestCache_OnDeletion(t *testing.T) {
+	cache := NewCache[string, int](&MemoryCacheConfig{
+		CacheCount:      10,
+		CacheTTLSeconds: 60,
+		CacheEnable:     true,
+	})
+
+	var mutex sync.Mutex
+	causes := make(map[string]DeletionCause)
+	cache.OnDeletion(func(key string, value int, cause DeletionCause) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		causes[key] = cause
+	})
+
+	cache.Set("explicit", 1)
+	cache.Delete("explicit")
+
+	cache.SetWithTTL("expired", 1, time.Second)
+
+	assert.Eventually(t, func() bool {
+		cache.Get("expired")
+		mutex.Lock()
+		defer mutex.Unlock()
+		return causes["explicit"] == CauseExplicit && causes["expired"] == CauseExpired
+	}, 5*time.Second, 100*time.Millisecond)
+
+	stats := cache.Stats()
+	assert.Equal(t, int64(1), stats.Deletions)
+	assert.Equal(t, int64(1), stats.Expirations)
+}
+
+func TestWritePrometheus(t *testing.T) {
+	users := NewCache[string, int](&testConfig, WithName("users"))
+	defer users.Close()
+	orders := NewCache[string, int](&testConfig, WithName("orders"))
+
+	users.Set("a", 1)
+	users.Get("a")
+	users.Get("b")
+
+	stats, ok := GetStats("users")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), stats.Hits)
+
+	var buf bytes.Buffer
+	assert.NoError(t, WritePrometheus(&buf))
+	output := buf.String()
+
+	assert.Contains(t, output, "# TYPE memory_cache_hits_total counter\n")
+	assert.Contains(t, output, `memory_cache_hits_total{cache="users"} 1`+"\n")
+	assert.Contains(t, output, `memory_cache_misses_total{cache="users"} 1`+"\n")
+	assert.Contains(t, output, `memory_cache_hit_ratio{cache="users"} 0.5`+"\n")
+	assert.Contains(t, output, `memory_cache_deletions_total{cache="users",cause="size"} 0`+"\n")
+	assert.Contains(t, output, `memory_cache_entries{cache="orders"} 0`+"\n")
+
+	orders.Close()
+	_, ok = GetStats("orders")
+	assert.False(t, ok, "Closed cache should be unregistered")
+}
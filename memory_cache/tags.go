@@ -0,0 +1,197 @@
+package memory_cache
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/btree"
+)
+
+// btreeDegree is the degree of the ordered key index, the default of the
+// btree package examples
+const btreeDegree = 32
+
+// tagIndex maps tags to keys so InvalidateTag only touches tagged entries,
+// and keeps string keys ordered so InvalidatePrefix only touches matching
+// ones.
+type tagIndex[K comparable] struct {
+	mutex   sync.Mutex
+	tagKeys map[string]map[K]struct{}
+	keyTags map[K][]string
+	ordered *btree.BTreeG[string] // string keys, nil until the first one
+	size    atomic.Int64          // len(keyTags), read without the lock on the Set path
+}
+
+func (ti *tagIndex[K]) set(key K, tags []string) {
+	s, isString := any(key).(string)
+	if !isString && len(tags) == 0 && ti.size.Load() == 0 {
+		return
+	}
+
+	ti.mutex.Lock()
+	defer ti.mutex.Unlock()
+
+	ti.removeTagsLocked(key)
+	if isString {
+		if ti.ordered == nil {
+			ti.ordered = btree.NewOrderedG[string](btreeDegree)
+		}
+		ti.ordered.ReplaceOrInsert(s)
+	}
+	if len(tags) == 0 {
+		return
+	}
+
+	if ti.tagKeys == nil {
+		ti.tagKeys = make(map[string]map[K]struct{})
+		ti.keyTags = make(map[K][]string)
+	}
+	for _, tag := range tags {
+		keys, ok := ti.tagKeys[tag]
+		if !ok {
+			keys = make(map[K]struct{})
+			ti.tagKeys[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	ti.keyTags[key] = tags
+	ti.size.Store(int64(len(ti.keyTags)))
+}
+
+func (ti *tagIndex[K]) remove(key K) {
+	if _, isString := any(key).(string); !isString && ti.size.Load() == 0 {
+		return
+	}
+	ti.mutex.Lock()
+	defer ti.mutex.Unlock()
+	ti.removeLocked(key)
+}
+
+func (ti *tagIndex[K]) removeLocked(key K) {
+	ti.removeTagsLocked(key)
+	if s, ok := any(key).(string); ok && ti.ordered != nil {
+		ti.ordered.Delete(s)
+	}
+}
+
+func (ti *tagIndex[K]) removeTagsLocked(key K) {
+	tags, ok := ti.keyTags[key]
+	if !ok {
+		return
+	}
+	for _, tag := range tags {
+		keys := ti.tagKeys[tag]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(ti.tagKeys, tag)
+		}
+	}
+	delete(ti.keyTags, key)
+	ti.size.Store(int64(len(ti.keyTags)))
+}
+
+func (ti *tagIndex[K]) get(key K) []string {
+	if ti.size.Load() == 0 {
+		return nil
+	}
+	ti.mutex.Lock()
+	defer ti.mutex.Unlock()
+	return ti.keyTags[key]
+}
+
+// take removes tag from the index and returns its keys.
+func (ti *tagIndex[K]) take(tag string) []K {
+	ti.mutex.Lock()
+	defer ti.mutex.Unlock()
+
+	keys := make([]K, 0, len(ti.tagKeys[tag]))
+	for key := range ti.tagKeys[tag] {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		ti.removeLocked(key)
+	}
+	return keys
+}
+
+// takePrefix removes the string keys starting with prefix from the index and
+// returns them.
+func (ti *tagIndex[K]) takePrefix(prefix string) []K {
+	ti.mutex.Lock()
+	defer ti.mutex.Unlock()
+
+	if ti.ordered == nil {
+		return nil
+	}
+	var keys []K
+	ti.ordered.AscendGreaterOrEqual(prefix, func(s string) bool {
+		if !strings.HasPrefix(s, prefix) {
+			return false
+		}
+		keys = append(keys, any(s).(K))
+		return true
+	})
+	for _, key := range keys {
+		ti.removeLocked(key)
+	}
+	return keys
+}
+
+func (ti *tagIndex[K]) clear() {
+	ti.mutex.Lock()
+	defer ti.mutex.Unlock()
+	ti.tagKeys = nil
+	ti.keyTags = nil
+	ti.ordered = nil
+	ti.size.Store(0)
+}
+
+// SetWithTags stores value with the default ttl and attaches tags to it,
+// replacing the tags of a previous value.
+func (mc *Cache[K, V]) SetWithTags(key K, value V, tags ...string) {
+	mc.SetWithTTLAndTags(key, value, mc.defaultTTL(), tags...)
+}
+
+func (mc *Cache[K, V]) SetWithTTLAndTags(key K, value V, ttl time.Duration, tags ...string) {
+	mc.writeMutex.RLock()
+	defer mc.writeMutex.RUnlock()
+
+	st := mc.state.Load()
+	if !st.enabled() {
+		return
+	}
+	mc.tags.set(key, tags)
+	st.memoryCache.Set(key, value, ttl)
+}
+
+// InvalidateTag deletes every entry set with tag and returns how many keys
+// were tagged. The cost is proportional to the number of tagged keys.
+func (mc *Cache[K, V]) InvalidateTag(tag string) int {
+	return mc.invalidate(func() []K { return mc.tags.take(tag) })
+}
+
+// InvalidatePrefix deletes every entry whose string key starts with prefix
+// and returns how many keys matched. The cost is proportional to the number
+// of matching keys, keys that are not strings never match.
+func (mc *Cache[K, V]) InvalidatePrefix(prefix string) int {
+	return mc.invalidate(func() []K { return mc.tags.takePrefix(prefix) })
+}
+
+// invalidate holds off writes between taking the keys from the index and
+// deleting them, so a key set meanwhile keeps both its value and its tags.
+func (mc *Cache[K, V]) invalidate(take func() []K) int {
+	mc.writeMutex.Lock()
+	defer mc.writeMutex.Unlock()
+
+	st := mc.state.Load()
+	if !st.enabled() {
+		return 0
+	}
+	keys := take()
+	for _, key := range keys {
+		st.memoryCache.Delete(key)
+	}
+	return len(keys)
+}
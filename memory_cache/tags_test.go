@@ -0,0 +1,142 @@
+package memory_cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_InvalidateTag(t *testing.T) {
+	cache := NewCache[string, string](&testConfig)
+
+	cache.SetWithTags("user:1", "alice", "tenant:a")
+	cache.SetWithTags("user:2", "bob", "tenant:a", "admins")
+	cache.SetWithTags("user:3", "carol", "tenant:b")
+	cache.Set("config", "global")
+
+	assert.Equal(t, 2, cache.InvalidateTag("tenant:a"))
+
+	_, ok := cache.Get("user:1")
+	assert.False(t, ok)
+	_, ok = cache.Get("user:2")
+	assert.False(t, ok)
+	_, ok = cache.Get("user:3")
+	assert.True(t, ok)
+	_, ok = cache.Get("config")
+	assert.True(t, ok)
+
+	assert.Equal(t, 0, cache.InvalidateTag("admins"), "Invalidated keys should leave their other tags")
+	assert.Equal(t, 0, cache.InvalidateTag("unknown"))
+}
+
+func TestCache_RetagOnSet(t *testing.T) {
+	cache := NewCache[string, string](&testConfig)
+
+	cache.SetWithTags("user:1", "alice", "tenant:a")
+	cache.SetWithTags("user:1", "alice", "tenant:b")
+	assert.Equal(t, 0, cache.InvalidateTag("tenant:a"))
+
+	cache.Set("user:1", "alice")
+	assert.Equal(t, 0, cache.InvalidateTag("tenant:b"), "Set without tags should drop previous tags")
+
+	cache.SetWithTags("user:2", "bob", "tenant:c")
+	cache.Delete("user:2")
+	assert.Equal(t, 0, cache.InvalidateTag("tenant:c"))
+	assert.Equal(t, int64(0), cache.tags.size.Load())
+}
+
+func TestCache_InvalidatePrefix(t *testing.T) {
+	cache := NewCache[string, int](&MemoryCacheConfig{
+		CacheCount:      300000,
+		CacheTTLSeconds: 60,
+		CacheEnable:     true,
+	})
+
+	for i := 0; i < 100000; i++ {
+		cache.SetWithTags(fmt.Sprintf("tenant:a:user:%d", i), i, "tenant:a")
+		cache.Set(fmt.Sprintf("tenant:b:user:%d", i), i)
+	}
+
+	assert.Equal(t, 100000, cache.InvalidatePrefix("tenant:a:"))
+	_, ok := cache.Get("tenant:a:user:1")
+	assert.False(t, ok)
+	_, ok = cache.Get("tenant:b:user:1")
+	assert.True(t, ok)
+	assert.Equal(t, int64(0), cache.tags.size.Load(), "Prefix invalidation should clean the tag index")
+
+	ints := NewCache[int, int](&testConfig)
+	ints.Set(1, 1)
+	assert.Equal(t, 0, ints.InvalidatePrefix(""), "Non string keys never match")
+}
+
+func TestCache_InvalidateTagConcurrentSet(t *testing.T) {
+	cache := NewCache[string, int](&testConfig)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("user:%d", i%10)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			cache.SetWithTags(key, i, "tenant:a")
+		}()
+		go func() {
+			defer wg.Done()
+			cache.InvalidateTag("tenant:a")
+		}()
+	}
+	wg.Wait()
+
+	// every key is either gone with its tags or cached with them
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("user:%d", i)
+		_, cached := cache.getQuietly(key)
+		assert.Equal(t, cached, len(cache.tags.get(key)) > 0, key)
+	}
+}
+
+func TestCache_InvalidatePrefixIndex(t *testing.T) {
+	cache := NewCache[string, string](&testConfig)
+
+	cache.Set("a", "1")
+	cache.Set("ab", "2")
+	cache.Set("abc", "3")
+	cache.Set("b", "4")
+	cache.Delete("ab")
+
+	assert.Equal(t, 1, cache.InvalidatePrefix("ab"))
+	assert.Equal(t, 0, cache.InvalidatePrefix("ab"))
+	_, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 2, cache.InvalidatePrefix(""))
+	assert.Equal(t, 0, cache.tags.ordered.Len())
+}
+
+func TestCache_InvalidateTagDuringReconfigure(t *testing.T) {
+	config := MemoryCacheConfig{CacheCount: 100000, CacheTTLSeconds: 60, CacheEnable: true}
+	cache := NewCache[string, int](&config)
+	for i := 0; i < 50000; i++ {
+		cache.SetWithTags(fmt.Sprintf("tenant:a:%d", i), i, "tenant:a")
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		resized := config
+		resized.CacheCount *= 2
+		assert.NoError(t, cache.Reconfigure(&resized))
+	}()
+	go func() {
+		defer wg.Done()
+		cache.InvalidateTag("tenant:a")
+	}()
+	wg.Wait()
+
+	// entries the invalidation missed still carry their tags
+	remaining := cache.Stats().Size
+	assert.Equal(t, remaining, cache.InvalidatePrefix("tenant:a:"))
+	assert.Equal(t, 0, cache.Stats().Size)
+}
@@ -0,0 +1,241 @@
+package memory_cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/dgdts/ts-gobase/codec"
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultInvalidationChannelPrefix = "memory_cache:invalidate:"
+
+type TieredCacheConfig struct {
+	L1                  MemoryCacheConfig `yaml:"l1"`
+	KeyPrefix           string            `yaml:"key_prefix"`           // prefix of the redis keys
+	RedisTTLSeconds     int               `yaml:"redis_ttl_seconds"`    // L2 ttl, 0 means no expiry
+	InvalidationChannel string            `yaml:"invalidation_channel"` // defaults to memory_cache:invalidate:<key_prefix>
+	ReadThrough         bool              `yaml:"read_through"`         // Get falls back to redis on a L1 miss
+	WriteThrough        bool              `yaml:"write_through"`        // Set writes redis, otherwise it only evicts the redis key
+	LoadTimeoutSeconds  int               `yaml:"load_timeout_seconds"` // limit of a GetOrLoad load, default 30
+}
+
+// TieredCache keeps a per process Cache in front of Redis. Set and Delete
+// publish the key on a Redis channel so every other instance sharing the
+// channel drops its L1 copy.
+type TieredCache[V any] struct {
+	l1         *Cache[string, V]
+	rdb        redis.UniversalClient
+	codec      codec.Codec[V]
+	config     TieredCacheConfig
+	instanceID string
+	pubsub     *redis.PubSub
+	loadGroup  loadGroup[string, V]
+	done       chan struct{}
+}
+
+type invalidationMessage struct {
+	Origin string   `json:"origin"`
+	Keys   []string `json:"keys"`
+}
+
+// NewTieredCache uses rdb as L2, usually redis.MustGetConnection(name) from the
+// redis package of this module. valueCodec defaults to codec.JSONCodec when
+// nil.
+func NewTieredCache[V any](config *TieredCacheConfig, rdb redis.UniversalClient, valueCodec codec.Codec[V]) (*TieredCache[V], error) {
+	if valueCodec == nil {
+		valueCodec = codec.JSONCodec[V]{}
+	}
+
+	instanceID := make([]byte, 8)
+	if _, err := rand.Read(instanceID); err != nil {
+		return nil, err
+	}
+
+	tc := &TieredCache[V]{
+		l1:         NewCache[string, V](&config.L1),
+		rdb:        rdb,
+		codec:      valueCodec,
+		config:     *config,
+		instanceID: hex.EncodeToString(instanceID),
+		done:       make(chan struct{}),
+	}
+	if tc.config.InvalidationChannel == "" {
+		tc.config.InvalidationChannel = defaultInvalidationChannelPrefix + tc.config.KeyPrefix
+	}
+	if tc.config.LoadTimeoutSeconds <= 0 {
+		tc.config.LoadTimeoutSeconds = int(defaultLoadTimeout / time.Second)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tc.pubsub = rdb.Subscribe(ctx, tc.config.InvalidationChannel)
+	// wait for the subscription so no invalidation is missed after we return
+	if _, err := tc.pubsub.Receive(ctx); err != nil {
+		_ = tc.pubsub.Close()
+		tc.l1.Close()
+		return nil, fmt.Errorf("failed to subscribe %s: %w", tc.config.InvalidationChannel, err)
+	}
+
+	go tc.listen()
+
+	return tc, nil
+}
+
+func (tc *TieredCache[V]) Get(ctx context.Context, key string) (V, bool) {
+	if value, ok := tc.l1.Get(key); ok {
+		return value, true
+	}
+	if !tc.config.ReadThrough {
+		var zero V
+		return zero, false
+	}
+
+	value, ok, err := tc.getL2(ctx, key)
+	if err != nil {
+		hlog.Warnf("tiered cache get %s from redis failed: %v", key, err)
+		return value, false
+	}
+	if ok {
+		tc.l1.Set(key, value)
+	}
+	return value, ok
+}
+
+// GetOrLoad looks up L1 then Redis, and on a miss in both calls loader and
+// stores the result in both levels. Concurrent misses share a single load,
+// which keeps the values of the first caller's context but not its
+// cancellation and is limited by LoadTimeoutSeconds.
+func (tc *TieredCache[V]) GetOrLoad(ctx context.Context, key string, loader func(ctx context.Context, key string) (V, error)) (V, error) {
+	if value, ok := tc.l1.Get(key); ok {
+		return value, nil
+	}
+
+	return tc.loadGroup.do(key, func() (V, error) {
+		if value, ok := tc.l1.getQuietly(key); ok {
+			return value, nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Duration(tc.config.LoadTimeoutSeconds)*time.Second)
+		defer cancel()
+
+		value, ok, err := tc.getL2(ctx, key)
+		if err != nil {
+			hlog.Warnf("tiered cache get %s from redis failed: %v", key, err)
+		}
+		if ok {
+			tc.l1.Set(key, value)
+			return value, nil
+		}
+
+		value, err = loader(ctx, key)
+		if err != nil {
+			return value, err
+		}
+		if err := tc.setL2(ctx, key, value); err != nil {
+			hlog.Warnf("tiered cache set %s to redis failed: %v", key, err)
+		}
+		tc.l1.Set(key, value)
+		return value, nil
+	})
+}
+
+// Set stores value in L1, writes or evicts the Redis copy depending on
+// WriteThrough and evicts the key from the L1 of the other instances.
+func (tc *TieredCache[V]) Set(ctx context.Context, key string, value V) error {
+	var err error
+	if tc.config.WriteThrough {
+		err = tc.setL2(ctx, key, value)
+	} else {
+		err = tc.rdb.Del(ctx, tc.redisKey(key)).Err()
+	}
+	if err != nil {
+		tc.l1.Delete(key)
+		return err
+	}
+
+	tc.l1.Set(key, value)
+	return tc.publish(ctx, key)
+}
+
+func (tc *TieredCache[V]) Delete(ctx context.Context, key string) error {
+	tc.l1.Delete(key)
+	if err := tc.rdb.Del(ctx, tc.redisKey(key)).Err(); err != nil {
+		return err
+	}
+	return tc.publish(ctx, key)
+}
+
+// Close stops listening for invalidations and releases the L1 cache, the
+// Redis client is left open.
+func (tc *TieredCache[V]) Close() error {
+	err := tc.pubsub.Close()
+	<-tc.done
+	tc.l1.Close()
+	return err
+}
+
+func (tc *TieredCache[V]) getL2(ctx context.Context, key string) (V, bool, error) {
+	var zero V
+	data, err := tc.rdb.Get(ctx, tc.redisKey(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return zero, false, nil
+	}
+	if err != nil {
+		return zero, false, err
+	}
+
+	value, err := tc.codec.Unmarshal(data)
+	if err != nil {
+		return zero, false, err
+	}
+	return value, true, nil
+}
+
+func (tc *TieredCache[V]) setL2(ctx context.Context, key string, value V) error {
+	data, err := tc.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	ttl := time.Duration(tc.config.RedisTTLSeconds) * time.Second
+	return tc.rdb.Set(ctx, tc.redisKey(key), data, ttl).Err()
+}
+
+func (tc *TieredCache[V]) redisKey(key string) string {
+	return tc.config.KeyPrefix + key
+}
+
+func (tc *TieredCache[V]) publish(ctx context.Context, keys ...string) error {
+	message, err := json.Marshal(invalidationMessage{
+		Origin: tc.instanceID,
+		Keys:   keys,
+	})
+	if err != nil {
+		return err
+	}
+	return tc.rdb.Publish(ctx, tc.config.InvalidationChannel, message).Err()
+}
+
+func (tc *TieredCache[V]) listen() {
+	defer close(tc.done)
+	for msg := range tc.pubsub.Channel() {
+		var message invalidationMessage
+		if err := json.Unmarshal([]byte(msg.Payload), &message); err != nil {
+			hlog.Warnf("tiered cache invalid message on %s: %v", msg.Channel, err)
+			continue
+		}
+		if message.Origin == tc.instanceID {
+			continue
+		}
+		for _, key := range message.Keys {
+			tc.l1.Delete(key)
+		}
+	}
+}
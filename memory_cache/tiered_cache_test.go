@@ -0,0 +1,186 @@
+package memory_cache
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+type profile struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func newTestTieredCache(t *testing.T, addr string, config TieredCacheConfig) *TieredCache[profile] {
+	rdb := redis.NewUniversalClient(&redis.UniversalOptions{Addrs: []string{addr}})
+	tc, err := NewTieredCache[profile](&config, rdb, nil)
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		_ = tc.Close()
+		_ = rdb.Close()
+	})
+	return tc
+}
+
+func TestTieredCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	config := TieredCacheConfig{
+		L1:           testConfig,
+		KeyPrefix:    "profile:",
+		ReadThrough:  true,
+		WriteThrough: true,
+	}
+
+	podA := newTestTieredCache(t, mr.Addr(), config)
+	podB := newTestTieredCache(t, mr.Addr(), config)
+
+	t.Run("Write Through And Read Through", func(t *testing.T) {
+		assert.NoError(t, podA.Set(ctx, "1", profile{Name: "alice", Age: 20}))
+		assert.True(t, mr.Exists("profile:1"))
+
+		v, ok := podB.Get(ctx, "1")
+		assert.True(t, ok)
+		assert.Equal(t, "alice", v.Name)
+
+		_, ok = podB.l1.Get("1")
+		assert.True(t, ok, "Read through should fill L1")
+	})
+
+	t.Run("Delete Evicts Other Instances", func(t *testing.T) {
+		assert.NoError(t, podA.Set(ctx, "2", profile{Name: "bob"}))
+		_, ok := podB.Get(ctx, "2")
+		assert.True(t, ok)
+
+		assert.NoError(t, podA.Delete(ctx, "2"))
+		assert.Eventually(t, func() bool {
+			_, ok := podB.l1.Get("2")
+			return !ok
+		}, time.Second, 10*time.Millisecond)
+		assert.False(t, mr.Exists("profile:2"))
+	})
+
+	t.Run("Set Evicts Stale Copies", func(t *testing.T) {
+		assert.NoError(t, podA.Set(ctx, "3", profile{Name: "carol", Age: 30}))
+		_, ok := podB.Get(ctx, "3")
+		assert.True(t, ok)
+
+		assert.NoError(t, podA.Set(ctx, "3", profile{Name: "carol", Age: 31}))
+		assert.Eventually(t, func() bool {
+			v, ok := podB.Get(ctx, "3")
+			return ok && v.Age == 31
+		}, time.Second, 10*time.Millisecond)
+
+		v, ok := podA.l1.Get("3")
+		assert.True(t, ok, "Own invalidations should not evict the local copy")
+		assert.Equal(t, 31, v.Age)
+	})
+
+	t.Run("GetOrLoad Fills Both Levels", func(t *testing.T) {
+		calls := 0
+		loader := func(ctx context.Context, key string) (profile, error) {
+			calls++
+			return profile{Name: "dave"}, nil
+		}
+
+		v, err := podA.GetOrLoad(ctx, "4", loader)
+		assert.NoError(t, err)
+		assert.Equal(t, "dave", v.Name)
+
+		v, err = podB.GetOrLoad(ctx, "4", loader)
+		assert.NoError(t, err)
+		assert.Equal(t, "dave", v.Name)
+		assert.Equal(t, 1, calls, "Second instance should load from redis")
+	})
+}
+
+func TestTieredCache_GetOrLoadCancelledCaller(t *testing.T) {
+	mr := miniredis.RunT(t)
+	tc := newTestTieredCache(t, mr.Addr(), TieredCacheConfig{L1: testConfig, KeyPrefix: "profile:"})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	loader := func(ctx context.Context, key string) (profile, error) {
+		close(started)
+		<-release
+		if err := ctx.Err(); err != nil {
+			return profile{}, err
+		}
+		return profile{Name: "erin"}, nil
+	}
+
+	// the first caller gives up while the shared load runs
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := tc.GetOrLoad(ctx, "5", loader)
+		first <- err
+	}()
+	<-started
+
+	waiter := make(chan error, 1)
+	go func() {
+		v, err := tc.GetOrLoad(context.Background(), "5", loader)
+		assert.Equal(t, "erin", v.Name)
+		waiter <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	close(release)
+	assert.NoError(t, <-first)
+	assert.NoError(t, <-waiter)
+	assert.True(t, mr.Exists("profile:5"))
+}
+
+func TestTieredCache_WriteInvalidate(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	config := TieredCacheConfig{
+		L1:        testConfig,
+		KeyPrefix: "profile:",
+	}
+
+	tc := newTestTieredCache(t, mr.Addr(), config)
+	assert.NoError(t, mr.Set("profile:1", `{"name":"old"}`))
+
+	assert.NoError(t, tc.Set(ctx, "1", profile{Name: "new"}))
+	assert.False(t, mr.Exists("profile:1"), "Set without write through should evict the redis key")
+
+	v, ok := tc.Get(ctx, "1")
+	assert.True(t, ok)
+	assert.Equal(t, "new", v.Name)
+}
+
+func TestTieredCache_Close(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewUniversalClient(&redis.UniversalOptions{Addrs: []string{mr.Addr()}})
+	t.Cleanup(func() { _ = rdb.Close() })
+	tc, err := NewTieredCache[profile](&TieredCacheConfig{L1: testConfig, KeyPrefix: "profile:"}, rdb, nil)
+	assert.NoError(t, err)
+
+	tc.l1.Set("1", profile{Name: "alice"})
+	assert.NoError(t, tc.Close())
+	_, ok := tc.l1.getQuietly("1")
+	assert.False(t, ok, "Close should release the L1 cache")
+}
+
+func TestTieredCache_SubscribeFailureClosesL1(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewUniversalClient(&redis.UniversalOptions{Addrs: []string{mr.Addr()}})
+	t.Cleanup(func() { _ = rdb.Close() })
+	mr.Close()
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 5; i++ {
+		_, err := NewTieredCache[profile](&TieredCacheConfig{L1: testConfig, KeyPrefix: "profile:"}, rdb, nil)
+		assert.Error(t, err)
+	}
+	assert.Eventually(t, func() bool {
+		return runtime.NumGoroutine() <= before
+	}, 3*time.Second, 50*time.Millisecond, "A failed subscribe should close the L1 cache")
+}
@@ -0,0 +1,234 @@
+package redis
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"reflect"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/dgdts/ts-gobase/codec"
+	redis "github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultFetchJitter  = 0.1
+	defaultFetchNullTTL = time.Minute
+	defaultFetchTimeout = 30 * time.Second
+)
+
+// first byte of every cached value
+const (
+	fetchFlagRaw byte = iota
+	fetchFlagGzip
+	fetchFlagNull
+)
+
+// ErrCacheNotFound is returned by a loader when the value does not exist.
+// Fetch caches the absence so the source is not hit again for every
+// request, and returns ErrCacheNotFound until it expires.
+var ErrCacheNotFound = errors.New("redis cache: value not found")
+
+var errCacheCorrupt = errors.New("redis cache: corrupt value")
+
+var fetchGroup singleflight.Group
+
+type FetchOption func(*fetchOptions)
+
+type fetchOptions struct {
+	client            redis.UniversalClient
+	connection        []string
+	codec             any // codec.Codec[T]
+	jitter            float64
+	nullTTL           time.Duration
+	compressThreshold int
+	loadTimeout       time.Duration
+}
+
+// WithFetchClient uses rdb instead of the default connection.
+func WithFetchClient(rdb redis.UniversalClient) FetchOption {
+	return func(o *fetchOptions) {
+		o.client = rdb
+	}
+}
+
+// WithFetchConnection uses the named connection of InitRedis.
+func WithFetchConnection(name string) FetchOption {
+	return func(o *fetchOptions) {
+		o.connection = []string{name}
+	}
+}
+
+// WithCodec replaces codec.JSONCodec, T must be the type fetched.
+func WithCodec[T any](c codec.Codec[T]) FetchOption {
+	return func(o *fetchOptions) {
+		o.codec = c
+	}
+}
+
+// WithTTLJitter adds up to fraction*ttl to each ttl so keys cached together
+// do not expire together, default 0.1, 0 disables.
+func WithTTLJitter(fraction float64) FetchOption {
+	return func(o *fetchOptions) {
+		o.jitter = fraction
+	}
+}
+
+// WithNullTTL sets how long ErrCacheNotFound is cached, default one minute
+// capped at the ttl, 0 disables null caching.
+func WithNullTTL(ttl time.Duration) FetchOption {
+	return func(o *fetchOptions) {
+		o.nullTTL = ttl
+	}
+}
+
+// WithCompression gzips encoded values of at least threshold bytes.
+func WithCompression(threshold int) FetchOption {
+	return func(o *fetchOptions) {
+		o.compressThreshold = threshold
+	}
+}
+
+// WithLoadTimeout limits the shared loader call, default 30s.
+func WithLoadTimeout(timeout time.Duration) FetchOption {
+	return func(o *fetchOptions) {
+		o.loadTimeout = timeout
+	}
+}
+
+// Fetch returns the cached value of key or loads, caches and returns it.
+// Concurrent misses of the same key in this process share one loader call.
+// It keeps the values of the first caller's context but not its
+// cancellation, so a caller giving up does not fail the others. Redis errors
+// are logged and the value is loaded as if missed.
+func Fetch[T any](ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (T, error), opts ...FetchOption) (T, error) {
+	var zero T
+	o := fetchOptions{codec: codec.JSONCodec[T]{}, jitter: defaultFetchJitter, nullTTL: min(defaultFetchNullTTL, ttl), loadTimeout: defaultFetchTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	valueCodec, ok := o.codec.(codec.Codec[T])
+	if !ok {
+		return zero, fmt.Errorf("redis cache: codec %T does not encode %s", o.codec, reflect.TypeFor[T]())
+	}
+
+	rdb := o.client
+	if rdb == nil {
+		var err error
+		if rdb, err = GetConnectionE(o.connection...); err != nil {
+			hlog.CtxWarnf(ctx, "redis cache %s unavailable, loading directly: %v", key, err)
+			return loader(ctx)
+		}
+	}
+
+	data, err := rdb.Get(ctx, key).Bytes()
+	if err == nil {
+		value, err := decodeCached(data, valueCodec)
+		if err == nil || errors.Is(err, ErrCacheNotFound) {
+			return value, err
+		}
+		hlog.CtxWarnf(ctx, "redis cache %s decode failed, reloading: %v", key, err)
+	} else if !errors.Is(err, redis.Nil) {
+		hlog.CtxWarnf(ctx, "redis cache get %s failed: %v", key, err)
+	}
+
+	// the type is part of the key, callers fetching one key as different
+	// types must not share a result
+	groupKey := fmt.Sprintf("%p|%s|%s", rdb, reflect.TypeFor[T](), key)
+	result, err, _ := fetchGroup.Do(groupKey, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), o.loadTimeout)
+		defer cancel()
+
+		value, err := loader(ctx)
+		if errors.Is(err, ErrCacheNotFound) {
+			if o.nullTTL > 0 {
+				setCached(ctx, rdb, key, []byte{fetchFlagNull}, o.nullTTL)
+			}
+			return value, err
+		}
+		if err != nil {
+			return value, err
+		}
+
+		data, err := encodeCached(value, valueCodec, o.compressThreshold)
+		if err != nil {
+			hlog.CtxWarnf(ctx, "redis cache %s encode failed: %v", key, err)
+			return value, nil
+		}
+		setCached(ctx, rdb, key, data, jitterTTL(ttl, o.jitter))
+		return value, nil
+	})
+	if value, ok := result.(T); ok {
+		return value, err
+	}
+	return zero, err
+}
+
+// setCached only logs failures, the loaded value is still good.
+func setCached(ctx context.Context, rdb redis.UniversalClient, key string, data []byte, ttl time.Duration) {
+	if err := rdb.Set(ctx, key, data, ttl).Err(); err != nil {
+		hlog.CtxWarnf(ctx, "redis cache set %s failed: %v", key, err)
+	}
+}
+
+func jitterTTL(ttl time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 || ttl <= 0 {
+		return ttl
+	}
+	return ttl + time.Duration(rand.Float64()*fraction*float64(ttl))
+}
+
+func encodeCached[T any](value T, valueCodec codec.Codec[T], compressThreshold int) ([]byte, error) {
+	data, err := valueCodec.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if compressThreshold <= 0 || len(data) < compressThreshold {
+		return append([]byte{fetchFlagRaw}, data...), nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(fetchFlagGzip)
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeCached reads compressed values whether or not compression is
+// enabled, so it can be turned on and off without flushing the cache.
+func decodeCached[T any](data []byte, valueCodec codec.Codec[T]) (T, error) {
+	var value T
+	if len(data) == 0 {
+		return value, errCacheCorrupt
+	}
+
+	payload := data[1:]
+	switch data[0] {
+	case fetchFlagNull:
+		return value, ErrCacheNotFound
+	case fetchFlagRaw:
+	case fetchFlagGzip:
+		r, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return value, err
+		}
+		if payload, err = io.ReadAll(r); err != nil {
+			return value, err
+		}
+	default:
+		return value, errCacheCorrupt
+	}
+
+	return valueCodec.Unmarshal(payload)
+}
@@ -0,0 +1,183 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dgdts/ts-gobase/codec"
+	"github.com/stretchr/testify/assert"
+)
+
+type cachedUser struct {
+	ID   int
+	Name string
+}
+
+func TestFetch_Codecs(t *testing.T) {
+	for name, valueCodec := range map[string]codec.Codec[cachedUser]{
+		"json":    codec.JSONCodec[cachedUser]{},
+		"msgpack": codec.MsgpackCodec[cachedUser]{},
+		"gob":     codec.GobCodec[cachedUser]{},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mr, rdb := newTestClient(t)
+			ctx := context.Background()
+
+			var loads int
+			loader := func(ctx context.Context) (cachedUser, error) {
+				loads++
+				return cachedUser{ID: 1, Name: "ann"}, nil
+			}
+			for i := 0; i < 2; i++ {
+				user, err := Fetch(ctx, "user:1", time.Minute, loader, WithFetchClient(rdb), WithCodec(valueCodec))
+				assert.NoError(t, err)
+				assert.Equal(t, cachedUser{ID: 1, Name: "ann"}, user)
+			}
+			assert.Equal(t, 1, loads)
+
+			ttl := mr.TTL("user:1")
+			assert.GreaterOrEqual(t, ttl, time.Minute)
+			assert.LessOrEqual(t, ttl, time.Minute+6*time.Second)
+		})
+	}
+}
+
+func TestFetch_CodecType(t *testing.T) {
+	_, rdb := newTestClient(t)
+	_, err := Fetch(context.Background(), "user:1", time.Minute, func(ctx context.Context) (cachedUser, error) {
+		return cachedUser{}, nil
+	}, WithFetchClient(rdb), WithCodec(codec.JSONCodec[int]{}))
+	assert.ErrorContains(t, err, "does not encode")
+}
+
+func TestFetch_NullValue(t *testing.T) {
+	mr, rdb := newTestClient(t)
+	ctx := context.Background()
+
+	var loads int
+	loader := func(ctx context.Context) (*cachedUser, error) {
+		loads++
+		return nil, ErrCacheNotFound
+	}
+	for i := 0; i < 3; i++ {
+		_, err := Fetch(ctx, "user:404", time.Hour, loader, WithFetchClient(rdb), WithNullTTL(10*time.Second))
+		assert.ErrorIs(t, err, ErrCacheNotFound)
+	}
+	assert.Equal(t, 1, loads)
+	assert.Equal(t, 10*time.Second, mr.TTL("user:404"))
+
+	mr.FastForward(11 * time.Second)
+	_, _ = Fetch(ctx, "user:404", time.Hour, loader, WithFetchClient(rdb))
+	assert.Equal(t, 2, loads)
+
+	// errors other than ErrCacheNotFound are not cached
+	_, err := Fetch(ctx, "user:500", time.Hour, func(ctx context.Context) (int, error) {
+		return 0, assert.AnError
+	}, WithFetchClient(rdb))
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.False(t, mr.Exists("user:500"))
+}
+
+func TestFetch_Singleflight(t *testing.T) {
+	_, rdb := newTestClient(t)
+	ctx := context.Background()
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (string, error) {
+		loads.Add(1)
+		<-release
+		return "value", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := Fetch(ctx, "hot", time.Minute, loader, WithFetchClient(rdb))
+			assert.NoError(t, err)
+			assert.Equal(t, "value", value)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), loads.Load())
+}
+
+func TestFetch_CancelledCaller(t *testing.T) {
+	_, rdb := newTestClient(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (string, error) {
+		close(started)
+		<-release
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		return "value", nil
+	}
+
+	// the first caller gives up while the shared load runs
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := Fetch(ctx, "hot", time.Minute, loader, WithFetchClient(rdb))
+		first <- err
+	}()
+	<-started
+
+	waiter := make(chan error, 1)
+	go func() {
+		value, err := Fetch(context.Background(), "hot", time.Minute, loader, WithFetchClient(rdb))
+		assert.Equal(t, "value", value)
+		waiter <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	close(release)
+	assert.NoError(t, <-first)
+	assert.NoError(t, <-waiter)
+}
+
+func TestFetch_Compression(t *testing.T) {
+	mr, rdb := newTestClient(t)
+	ctx := context.Background()
+	large := strings.Repeat("redis ", 1000)
+	loader := func(ctx context.Context) (string, error) { return large, nil }
+
+	value, err := Fetch(ctx, "large", time.Minute, loader, WithFetchClient(rdb), WithCompression(1024))
+	assert.NoError(t, err)
+	assert.Equal(t, large, value)
+
+	stored, err := mr.Get("large")
+	assert.NoError(t, err)
+	assert.Equal(t, fetchFlagGzip, stored[0])
+	assert.Less(t, len(stored), len(large)/10)
+
+	// read back without the option
+	value, err = Fetch(ctx, "large", time.Minute, func(ctx context.Context) (string, error) {
+		t.Fatal("loader called on a hit")
+		return "", nil
+	}, WithFetchClient(rdb))
+	assert.NoError(t, err)
+	assert.Equal(t, large, value)
+}
+
+func TestFetch_CorruptValueReloads(t *testing.T) {
+	mr, rdb := newTestClient(t)
+	assert.NoError(t, mr.Set("k", "not json"))
+
+	value, err := Fetch(context.Background(), "k", time.Minute, func(ctx context.Context) (int, error) {
+		return 7, nil
+	}, WithFetchClient(rdb), WithTTLJitter(0))
+	assert.NoError(t, err)
+	assert.Equal(t, 7, value)
+	assert.Equal(t, time.Minute, mr.TTL("k"))
+}
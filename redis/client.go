@@ -1,15 +1,40 @@
 package redis
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
+	"github.com/cloudwego/hertz/pkg/common/hlog"
 	redis "github.com/redis/go-redis/v9"
+	"gopkg.in/yaml.v3"
 )
 
 const defaultClientName = "default"
 
+var (
+	ErrClientNotFound = errors.New("redis client not found")
+	ErrNoAddrs        = errors.New("redis universal_addrs is empty")
+	ErrClusterDB      = errors.New("redis cluster only has db 0")
+	ErrClientClosed   = errors.New("redis client closed")
+)
+
+// backoff of the background reconnection after a failed ping
+var (
+	reconnectMinBackoff = 100 * time.Millisecond
+	reconnectMaxBackoff = 30 * time.Second
+)
+
+// how long a client replaced by InitRedis may finish its commands before
+// it is closed
+var (
+	drainTimeout  = 30 * time.Second
+	drainInterval = 50 * time.Millisecond
+)
+
 type RedisClient struct {
 	UniversalAddrs []string `yaml:"universal_addrs"`
 	Password       string   `yaml:"password"`
@@ -18,11 +43,38 @@ type RedisClient struct {
 	PoolSize       int      `yaml:"pool_size"`
 	MasterName     string   `yaml:"master_name"`
 
-	client redis.UniversalClient
-	once   sync.Once
+	Username         string    `yaml:"username"` // ACL user
+	TLS              TLSConfig `yaml:"tls"`
+	DialTimeoutMs    int       `yaml:"dial_timeout_ms"`
+	ReadTimeoutMs    int       `yaml:"read_timeout_ms"`
+	WriteTimeoutMs   int       `yaml:"write_timeout_ms"`
+	MinIdleConns     int       `yaml:"min_idle_conns"`
+	MaxRetries       int       `yaml:"max_retries"` // -1 disables retries
+	SentinelUsername string    `yaml:"sentinel_username"`
+	SentinelPassword string    `yaml:"sentinel_password"`
+	ReadOnly         bool      `yaml:"read_only"`        // cluster: read from replicas
+	RouteByLatency   bool      `yaml:"route_by_latency"` // cluster: read from the closest node, implies read_only
+	RouteRandomly    bool      `yaml:"route_randomly"`   // cluster: read from a random node, implies read_only
+	ClientName       string    `yaml:"client_name"`
+
+	Instrumentation InstrumentationConfig `yaml:"instrumentation"`
+
+	name      string // key in InitRedis, labels logs and metrics
+	client    redis.UniversalClient
+	configErr error
+	once      sync.Once
+
+	stateMutex   sync.Mutex
+	connected    bool  // a ping succeeded once, go-redis redials on its own after that
+	lastErr      error // of the pings before the first success
+	reconnecting bool
+	metrics      *commandMetrics
+	closed       bool
+	done         chan struct{} // closed by close, stops the reconnection
 }
 
 type redisClientManager struct {
+	mutex         sync.RWMutex
 	connectionMap map[string]*RedisClient
 }
 
@@ -38,65 +90,296 @@ func getRedisClientManagerInstance() *redisClientManager {
 	return redisClientManagerInstance
 }
 
-func (rcm *redisClientManager) updateConfigs(configs map[string]*RedisClient) {
-	rcm.connectionMap = configs
+// updateConfigs swaps in configs and returns the clients it replaced or
+// removed. A name whose config did not change keeps its client.
+func (rcm *redisClientManager) updateConfigs(configs map[string]*RedisClient) []*RedisClient {
+	rcm.mutex.Lock()
+	defer rcm.mutex.Unlock()
+
+	connectionMap := make(map[string]*RedisClient, len(configs))
+	kept := make(map[*RedisClient]bool, len(configs))
+	for name, config := range configs {
+		if old, ok := rcm.connectionMap[name]; ok && old.sameConfig(config) {
+			config = old
+		} else {
+			config.name = name
+		}
+		connectionMap[name] = config
+		kept[config] = true
+	}
+
+	var replaced []*RedisClient
+	for _, old := range rcm.connectionMap {
+		if !kept[old] {
+			kept[old] = true // a config shared by several names is closed once
+			replaced = append(replaced, old)
+		}
+	}
+	rcm.connectionMap = connectionMap
+	return replaced
 }
 
-func (rcm *redisClientManager) getClient(name string) redis.UniversalClient {
+func (rcm *redisClientManager) getConfig(name string) (*RedisClient, error) {
+	rcm.mutex.RLock()
+	defer rcm.mutex.RUnlock()
 	client, ok := rcm.connectionMap[name]
 	if !ok {
-		panic("cannot get redis name:" + name)
+		return nil, fmt.Errorf("%w: %s", ErrClientNotFound, name)
+	}
+	return client, nil
+}
+
+func (rcm *redisClientManager) getClient(name string) (redis.UniversalClient, error) {
+	client, err := rcm.getConfig(name)
+	if err != nil {
+		return nil, err
 	}
 	return client.connect()
 }
 
-func (r *RedisClient) connect() redis.UniversalClient {
+func (r *RedisClient) options() (*redis.UniversalOptions, error) {
+	isCluster := r.MasterName == "" && len(r.UniversalAddrs) > 1
+	if isCluster && r.DB != 0 {
+		return nil, ErrClusterDB
+	}
+
+	tlsConfig, err := r.TLS.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return &redis.UniversalOptions{
+		Addrs:            r.UniversalAddrs,
+		MasterName:       r.MasterName,
+		DB:               r.DB,
+		Username:         r.Username,
+		Password:         r.Password,
+		SentinelUsername: r.SentinelUsername,
+		SentinelPassword: r.SentinelPassword,
+		ClientName:       r.ClientName,
+		TLSConfig:        tlsConfig,
+		PoolSize:         r.PoolSize,
+		MinIdleConns:     r.MinIdleConns,
+		MaxRetries:       r.MaxRetries,
+		ConnMaxIdleTime:  time.Duration(r.IdleTimeout) * time.Second,
+		DialTimeout:      time.Duration(r.DialTimeoutMs) * time.Millisecond,
+		ReadTimeout:      time.Duration(r.ReadTimeoutMs) * time.Millisecond,
+		WriteTimeout:     time.Duration(r.WriteTimeoutMs) * time.Millisecond,
+		ReadOnly:         r.ReadOnly,
+		RouteByLatency:   r.RouteByLatency,
+		RouteRandomly:    r.RouteRandomly,
+	}, nil
+}
+
+// connect creates the client on first use. Until a first ping succeeds the
+// client reconnects in the background and connect returns the ping error,
+// later failures are left to the redials of go-redis.
+func (r *RedisClient) connect() (redis.UniversalClient, error) {
+	if len(r.UniversalAddrs) == 0 {
+		return nil, ErrNoAddrs
+	}
+
 	r.once.Do(func() {
-		switch {
-		case r.MasterName != "":
-			r.client = redis.NewUniversalClient(&redis.UniversalOptions{
-				Addrs:           r.UniversalAddrs,
-				MasterName:      r.MasterName,
-				Password:        r.Password,
-				PoolSize:        r.PoolSize,
-				ConnMaxIdleTime: time.Duration(r.IdleTimeout) * time.Second,
-			})
-		case len(r.UniversalAddrs) == 1:
-			r.client = redis.NewUniversalClient(&redis.UniversalOptions{
-				Addrs:           r.UniversalAddrs,
-				Password:        r.Password,
-				PoolSize:        r.PoolSize,
-				ConnMaxIdleTime: time.Duration(r.IdleTimeout) * time.Second,
-				DB:              r.DB,
-			})
-		default:
-			r.client = redis.NewUniversalClient(&redis.UniversalOptions{
-				Addrs:           r.UniversalAddrs,
-				Password:        r.Password,
-				PoolSize:        r.PoolSize,
-				ConnMaxIdleTime: time.Duration(r.IdleTimeout) * time.Second,
-			})
+		options, err := r.options()
+		if err != nil {
+			// a bad config does not get better by retrying
+			r.configErr = err
+			return
+		}
+		r.client = redis.NewUniversalClient(options)
+		r.instrument()
+		_, err = r.client.Ping(context.Background()).Result()
+		r.setConnected(err)
+	})
+	if r.configErr != nil {
+		return nil, r.configErr
+	}
+
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if r.closed {
+		return nil, ErrClientClosed
+	}
+	if !r.connected {
+		return nil, fmt.Errorf("connect redis[%s] failed: %w", r.UniversalAddrs[0], r.lastErr)
+	}
+	return r.client, nil
+}
+
+// instrument installs the hook of the instrumentation config.
+func (r *RedisClient) instrument() {
+	if !r.Instrumentation.enabled() {
+		return
+	}
+	var metrics *commandMetrics
+	if r.Instrumentation.Metrics {
+		metrics = newCommandMetrics()
+	}
+	r.client.AddHook(newInstrumentationHook(r.name, r.address(), r.Instrumentation, metrics))
+
+	r.stateMutex.Lock()
+	r.metrics = metrics
+	r.stateMutex.Unlock()
+}
+
+// setConnected records the first ping and starts reconnecting after a
+// failure.
+func (r *RedisClient) setConnected(err error) {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+
+	r.connected = err == nil
+	r.lastErr = err
+	if err != nil && !r.reconnecting && !r.closed {
+		r.reconnecting = true
+		// the backoff is read once, changing it does not race a running loop
+		go r.reconnect(r.doneChan(), reconnectMinBackoff, reconnectMaxBackoff)
+	}
+}
+
+// doneChan must be called with stateMutex held.
+func (r *RedisClient) doneChan() chan struct{} {
+	if r.done == nil {
+		r.done = make(chan struct{})
+	}
+	return r.done
+}
+
+func (r *RedisClient) reconnect(done <-chan struct{}, backoff, maxBackoff time.Duration) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(backoff):
 		}
 
 		_, err := r.client.Ping(context.Background()).Result()
-		if err != nil {
-			panic("connect redis[" + r.UniversalAddrs[0] + "] failed:" + err.Error())
+
+		r.stateMutex.Lock()
+		r.connected = err == nil
+		r.lastErr = err
+		if err == nil {
+			r.reconnecting = false
+			r.stateMutex.Unlock()
+			hlog.Infof("redis[%s] reconnected", r.UniversalAddrs[0])
+			return
 		}
-	})
-	return r.client
+		r.stateMutex.Unlock()
+
+		hlog.Warnf("redis[%s] reconnect failed, retry in %s: %v", r.UniversalAddrs[0], backoff, err)
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// close stops the reconnection and closes the client, it may be called
+// before the client was ever connected.
+func (r *RedisClient) close() error {
+	r.stateMutex.Lock()
+	if r.closed {
+		r.stateMutex.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.doneChan())
+	r.stateMutex.Unlock()
+
+	// waits for a connect in progress and keeps later ones from connecting
+	r.once.Do(func() { r.configErr = ErrClientClosed })
+	if r.client == nil {
+		return nil
+	}
+	return r.client.Close()
+}
+
+// drainAndClose closes the client once none of its connections is in use,
+// or after drainTimeout.
+func (r *RedisClient) drainAndClose() {
+	// nobody connects a replaced config, and r.client is safe to read after
+	r.once.Do(func() { r.configErr = ErrClientClosed })
+
+	deadline := time.Now().Add(drainTimeout)
+	r.stateMutex.Lock()
+	done := r.doneChan()
+	r.stateMutex.Unlock()
+	for time.Now().Before(deadline) {
+		if r.client == nil || r.idle() {
+			break
+		}
+		select {
+		case <-done: // closed by Close meanwhile
+			return
+		case <-time.After(drainInterval):
+		}
+	}
+	if err := r.close(); err != nil {
+		hlog.Warnf("close redis[%s] failed: %v", r.address(), err)
+	}
+}
+
+func (r *RedisClient) idle() bool {
+	stats := r.client.PoolStats()
+	return stats.TotalConns == stats.IdleConns
+}
+
+func (r *RedisClient) address() string {
+	if len(r.UniversalAddrs) == 0 {
+		return ""
+	}
+	return r.UniversalAddrs[0]
+}
+
+// sameConfig compares the yaml form, which holds exactly the configured
+// fields.
+func (r *RedisClient) sameConfig(other *RedisClient) bool {
+	if r == other {
+		return true
+	}
+	a, errA := yaml.Marshal(r)
+	b, errB := yaml.Marshal(other)
+	return errA == nil && errB == nil && bytes.Equal(a, b)
 }
 
+// InitRedis may be called again to reload the configs. Names with a changed
+// config get a new client on next use, the clients they replace are closed
+// in the background once their commands finished. Fetch clients per use
+// rather than keeping them, a kept client fails after a reload.
 func InitRedis(configs map[string]*RedisClient) {
-	getRedisClientManagerInstance().updateConfigs(configs)
+	replaced := getRedisClientManagerInstance().updateConfigs(configs)
+	for _, old := range replaced {
+		go old.drainAndClose()
+	}
+}
+
+// Close closes every client for shutdown, GetConnectionE fails afterwards
+// until the next InitRedis.
+func Close() error {
+	replaced := getRedisClientManagerInstance().updateConfigs(nil)
+	var errs []error
+	for _, old := range replaced {
+		if err := old.close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
 
-func GetConnection(redisName ...string) redis.UniversalClient {
-	var clientName string
+func clientName(redisName []string) string {
 	if len(redisName) == 0 {
-		clientName = defaultClientName
-	} else {
-		clientName = redisName[0]
+		return defaultClientName
 	}
+	return redisName[0]
+}
 
-	return getRedisClientManagerInstance().getClient(clientName)
+// GetConnectionE returns the named client, "default" without a name. It
+// fails for unknown names and while the client cannot reach redis.
+func GetConnectionE(redisName ...string) (redis.UniversalClient, error) {
+	return getRedisClientManagerInstance().getClient(clientName(redisName))
+}
+
+func MustGetConnection(redisName ...string) redis.UniversalClient {
+	client, err := GetConnectionE(redisName...)
+	if err != nil {
+		panic(err)
+	}
+	return client
 }
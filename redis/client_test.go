@@ -0,0 +1,188 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := l.Addr().String()
+	assert.NoError(t, l.Close())
+	return addr
+}
+
+func TestGetConnectionE(t *testing.T) {
+	mr := miniredis.RunT(t)
+	InitRedis(map[string]*RedisClient{
+		"default": {UniversalAddrs: []string{mr.Addr()}},
+		"empty":   {},
+	})
+
+	client, err := GetConnectionE()
+	assert.NoError(t, err)
+	assert.NoError(t, client.Set(context.Background(), "k", "v", 0).Err())
+	assert.Same(t, client, MustGetConnection("default"))
+
+	_, err = GetConnectionE("missing")
+	assert.ErrorIs(t, err, ErrClientNotFound)
+	assert.Panics(t, func() { MustGetConnection("missing") })
+
+	_, err = GetConnectionE("empty")
+	assert.ErrorIs(t, err, ErrNoAddrs)
+}
+
+func TestReconnect(t *testing.T) {
+	reconnectMinBackoff, reconnectMaxBackoff = 10*time.Millisecond, 50*time.Millisecond
+	t.Cleanup(func() {
+		reconnectMinBackoff, reconnectMaxBackoff = 100*time.Millisecond, 30*time.Second
+	})
+
+	addr := freeAddr(t)
+	InitRedis(map[string]*RedisClient{
+		"late": {UniversalAddrs: []string{addr}},
+	})
+	t.Cleanup(func() { _ = Close() })
+
+	// redis is down at startup, no panic
+	_, err := GetConnectionE("late")
+	assert.Error(t, err)
+	status, err := HealthCheck(context.Background(), "late")
+	assert.NoError(t, err)
+	assert.False(t, status.Healthy)
+	assert.NotEmpty(t, status.Error)
+
+	mr := miniredis.NewMiniRedis()
+	assert.NoError(t, mr.StartAddr(addr))
+	t.Cleanup(mr.Close)
+
+	assert.Eventually(t, func() bool {
+		_, err := GetConnectionE("late")
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestHealthCheck(t *testing.T) {
+	mr := miniredis.RunT(t)
+	InitRedis(map[string]*RedisClient{
+		"a": {UniversalAddrs: []string{mr.Addr()}},
+		"b": {UniversalAddrs: []string{mr.Addr()}, DB: 1},
+	})
+
+	status, err := HealthCheck(context.Background(), "a")
+	assert.NoError(t, err)
+	assert.True(t, status.Healthy)
+	assert.Equal(t, "a", status.Name)
+	assert.Positive(t, status.Latency)
+	assert.NotNil(t, status.PoolStats)
+	assert.Positive(t, status.PoolStats.TotalConns)
+
+	_, err = HealthCheck(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrClientNotFound)
+
+	statuses := HealthCheckAll(context.Background())
+	assert.Len(t, statuses, 2)
+	assert.True(t, statuses["b"].Healthy)
+}
+
+func TestHealthCheck_FailedProbeKeepsConnection(t *testing.T) {
+	mr := miniredis.RunT(t)
+	InitRedis(map[string]*RedisClient{"a": {UniversalAddrs: []string{mr.Addr()}}})
+	t.Cleanup(func() { _ = Close() })
+	client := MustGetConnection("a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	status, err := HealthCheck(ctx, "a")
+	assert.NoError(t, err)
+	assert.False(t, status.Healthy)
+	assert.NotEmpty(t, status.Error)
+
+	// a redis blip after the first connection is left to go-redis
+	mr.Close()
+	status, _ = HealthCheck(context.Background(), "a")
+	assert.False(t, status.Healthy)
+	assert.NotPanics(t, func() { assert.Same(t, client, MustGetConnection("a")) })
+
+	assert.NoError(t, mr.Restart())
+	assert.NoError(t, client.Ping(context.Background()).Err())
+}
+
+func TestInitRedisReload(t *testing.T) {
+	mr1 := miniredis.RunT(t)
+	mr2 := miniredis.RunT(t)
+	InitRedis(map[string]*RedisClient{
+		"same":    {UniversalAddrs: []string{mr1.Addr()}},
+		"changed": {UniversalAddrs: []string{mr1.Addr()}},
+		"removed": {UniversalAddrs: []string{mr1.Addr()}},
+	})
+	t.Cleanup(func() { _ = Close() })
+	same := MustGetConnection("same")
+	changed := MustGetConnection("changed")
+	removed := MustGetConnection("removed")
+
+	InitRedis(map[string]*RedisClient{
+		"same":    {UniversalAddrs: []string{mr1.Addr()}},
+		"changed": {UniversalAddrs: []string{mr2.Addr()}},
+	})
+	ctx := context.Background()
+	assert.Same(t, same, MustGetConnection("same"))
+	assert.NoError(t, same.Ping(ctx).Err())
+
+	assert.NotSame(t, changed, MustGetConnection("changed"))
+	assert.NoError(t, MustGetConnection("changed").Set(ctx, "k", "v", 0).Err())
+	assert.True(t, mr2.Exists("k"))
+
+	_, err := GetConnectionE("removed")
+	assert.ErrorIs(t, err, ErrClientNotFound)
+	for _, old := range []redis.UniversalClient{changed, removed} {
+		assert.Eventually(t, func() bool {
+			return errors.Is(old.Ping(ctx).Err(), redis.ErrClosed)
+		}, time.Second, 10*time.Millisecond)
+	}
+}
+
+func TestInitRedisDrain(t *testing.T) {
+	mr := miniredis.RunT(t)
+	InitRedis(map[string]*RedisClient{"default": {UniversalAddrs: []string{mr.Addr()}}})
+	t.Cleanup(func() { _ = Close() })
+	old := MustGetConnection()
+
+	ctx := context.Background()
+	blocked := make(chan error, 1)
+	go func() {
+		blocked <- old.BLPop(ctx, time.Second, "queue").Err()
+	}()
+	assert.Eventually(t, func() bool {
+		return old.PoolStats().TotalConns > old.PoolStats().IdleConns
+	}, time.Second, 5*time.Millisecond)
+
+	InitRedis(map[string]*RedisClient{"default": {UniversalAddrs: []string{mr.Addr()}, DB: 1}})
+	// the command in flight finishes on the replaced client
+	assert.ErrorIs(t, <-blocked, redis.Nil)
+	assert.Eventually(t, func() bool {
+		return errors.Is(old.Ping(ctx).Err(), redis.ErrClosed)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestClose(t *testing.T) {
+	mr := miniredis.RunT(t)
+	InitRedis(map[string]*RedisClient{
+		"a":    {UniversalAddrs: []string{mr.Addr()}},
+		"idle": {UniversalAddrs: []string{mr.Addr()}},
+	})
+	client := MustGetConnection("a")
+
+	assert.NoError(t, Close())
+	assert.ErrorIs(t, client.Ping(context.Background()).Err(), redis.ErrClosed)
+	_, err := GetConnectionE("a")
+	assert.ErrorIs(t, err, ErrClientNotFound)
+}
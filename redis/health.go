@@ -0,0 +1,65 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+type HealthStatus struct {
+	Name      string           `json:"name"`
+	Healthy   bool             `json:"healthy"`
+	Latency   time.Duration    `json:"latency"`
+	Error     string           `json:"error,omitempty"`
+	PoolStats *redis.PoolStats `json:"pool_stats,omitempty"`
+	CheckedAt time.Time        `json:"checked_at"`
+}
+
+// HealthCheck pings the named client and reports its latency and pool stats.
+// It only reports, a failed probe does not change what GetConnectionE returns.
+func HealthCheck(ctx context.Context, name string) (HealthStatus, error) {
+	config, err := getRedisClientManagerInstance().getConfig(name)
+	if err != nil {
+		return HealthStatus{}, err
+	}
+	return config.healthCheck(ctx, name), nil
+}
+
+// HealthCheckAll checks every configured client.
+func HealthCheckAll(ctx context.Context) map[string]HealthStatus {
+	rcm := getRedisClientManagerInstance()
+	rcm.mutex.RLock()
+	configs := make(map[string]*RedisClient, len(rcm.connectionMap))
+	for name, config := range rcm.connectionMap {
+		configs[name] = config
+	}
+	rcm.mutex.RUnlock()
+
+	statuses := make(map[string]HealthStatus, len(configs))
+	for name, config := range configs {
+		statuses[name] = config.healthCheck(ctx, name)
+	}
+	return statuses
+}
+
+func (r *RedisClient) healthCheck(ctx context.Context, name string) HealthStatus {
+	status := HealthStatus{Name: name, CheckedAt: time.Now()}
+
+	// a client that never connected is pinged again below
+	if _, err := r.connect(); err != nil && r.client == nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	start := time.Now()
+	_, err := r.client.Ping(ctx).Result()
+	status.Latency = time.Since(start)
+	status.PoolStats = r.client.PoolStats()
+
+	status.Healthy = err == nil
+	if err != nil {
+		status.Error = err.Error()
+	}
+	return status
+}
@@ -0,0 +1,331 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	redis "github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName      = "github.com/dgdts/ts-gobase/redis"
+	pipelineCommand = "pipeline"
+)
+
+// upper bounds of the latency histogram
+var latencyBuckets = []time.Duration{
+	500 * time.Microsecond,
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+type InstrumentationConfig struct {
+	Metrics   bool `yaml:"metrics"`     // per command latency histograms, error counts and pool stats
+	SlowLogMs int  `yaml:"slow_log_ms"` // log commands slower than this, 0 disables
+	Tracing   bool `yaml:"tracing"`     // OpenTelemetry spans from the global tracer provider
+}
+
+func (c InstrumentationConfig) enabled() bool {
+	return c.Metrics || c.SlowLogMs > 0 || c.Tracing
+}
+
+// CommandStats is a point in time copy of the counters of one command, a
+// pipeline counts as the command "pipeline".
+type CommandStats struct {
+	Calls   int64
+	Errors  int64 // redis.Nil is not an error
+	Total   time.Duration
+	Buckets []int64 // calls per latencyBuckets bound, the last one is +Inf
+}
+
+type commandMetrics struct {
+	mutex    sync.Mutex
+	commands map[string]*CommandStats
+}
+
+func newCommandMetrics() *commandMetrics {
+	return &commandMetrics{commands: make(map[string]*CommandStats)}
+}
+
+func (m *commandMetrics) observe(command string, elapsed time.Duration, failed bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stats, ok := m.commands[command]
+	if !ok {
+		stats = &CommandStats{Buckets: make([]int64, len(latencyBuckets)+1)}
+		m.commands[command] = stats
+	}
+	stats.Calls++
+	stats.Total += elapsed
+	if failed {
+		stats.Errors++
+	}
+	bucket := sort.Search(len(latencyBuckets), func(i int) bool { return elapsed <= latencyBuckets[i] })
+	stats.Buckets[bucket]++
+}
+
+func (m *commandMetrics) snapshot() map[string]CommandStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	snapshot := make(map[string]CommandStats, len(m.commands))
+	for command, stats := range m.commands {
+		copied := *stats
+		copied.Buckets = append([]int64(nil), stats.Buckets...)
+		snapshot[command] = copied
+	}
+	return snapshot
+}
+
+type instrumentationHook struct {
+	name    string
+	addr    string
+	metrics *commandMetrics
+	slowLog time.Duration
+	tracer  trace.Tracer
+}
+
+func newInstrumentationHook(name, addr string, config InstrumentationConfig, metrics *commandMetrics) *instrumentationHook {
+	hook := &instrumentationHook{
+		name:    name,
+		addr:    addr,
+		metrics: metrics,
+		slowLog: time.Duration(config.SlowLogMs) * time.Millisecond,
+	}
+	if config.Tracing {
+		hook.tracer = otel.Tracer(tracerName)
+	}
+	return hook
+}
+
+func (h *instrumentationHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *instrumentationHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, span := h.startSpan(ctx, cmd.Name(), cmd)
+		start := time.Now()
+		err := next(ctx, cmd)
+		h.finish(ctx, span, cmd.Name(), []redis.Cmder{cmd}, time.Since(start), err)
+		return err
+	}
+}
+
+func (h *instrumentationHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, span := h.startSpan(ctx, pipelineCommand, cmds...)
+		start := time.Now()
+		err := next(ctx, cmds)
+		h.finish(ctx, span, pipelineCommand, cmds, time.Since(start), err)
+		return err
+	}
+}
+
+func (h *instrumentationHook) startSpan(ctx context.Context, command string, cmds ...redis.Cmder) (context.Context, trace.Span) {
+	if h.tracer == nil {
+		return ctx, nil
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "redis"),
+		attribute.String("db.operation", command),
+		attribute.String("db.redis.client", h.name),
+	}
+	if host, port, err := net.SplitHostPort(h.addr); err == nil {
+		attrs = append(attrs, attribute.String("server.address", host), attribute.String("server.port", port))
+	}
+	if command == pipelineCommand {
+		attrs = append(attrs, attribute.Int("db.redis.num_cmd", len(cmds)))
+	}
+	return h.tracer.Start(ctx, "redis."+command, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+func (h *instrumentationHook) finish(ctx context.Context, span trace.Span, command string, cmds []redis.Cmder, elapsed time.Duration, err error) {
+	err = firstError(cmds, err)
+
+	if h.metrics != nil {
+		h.metrics.observe(command, elapsed, err != nil)
+	}
+	if h.slowLog > 0 && elapsed >= h.slowLog {
+		hlog.CtxWarnf(ctx, "redis[%s] slow command %s took %s", h.name, describeCommands(cmds), elapsed)
+	}
+	if span != nil {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// firstError skips redis.Nil, a missing key is a normal answer.
+func firstError(cmds []redis.Cmder, err error) error {
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+	}
+	return nil
+}
+
+// describeCommands names the commands and their first key, values are left
+// out of the log.
+func describeCommands(cmds []redis.Cmder) string {
+	names := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		name := cmd.Name()
+		if args := cmd.Args(); len(args) > 1 {
+			name += fmt.Sprintf(" %v", args[1])
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// GetCommandStats returns the command counters of the named client, false
+// when the client has no metrics or has not connected yet.
+func GetCommandStats(name string) (map[string]CommandStats, bool) {
+	config, err := getRedisClientManagerInstance().getConfig(name)
+	if err != nil {
+		return nil, false
+	}
+	metrics := config.commandMetrics()
+	if metrics == nil {
+		return nil, false
+	}
+	return metrics.snapshot(), true
+}
+
+func (r *RedisClient) commandMetrics() *commandMetrics {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	return r.metrics
+}
+
+type poolMetric struct {
+	name  string
+	help  string
+	kind  string
+	value func(s *redis.PoolStats) float64
+}
+
+var poolMetrics = []poolMetric{
+	{name: "redis_pool_hits_total", help: "Number of times a free connection was found in the pool.", kind: "counter", value: func(s *redis.PoolStats) float64 { return float64(s.Hits) }},
+	{name: "redis_pool_misses_total", help: "Number of times a free connection was not found in the pool.", kind: "counter", value: func(s *redis.PoolStats) float64 { return float64(s.Misses) }},
+	{name: "redis_pool_timeouts_total", help: "Number of times a wait for a connection timed out.", kind: "counter", value: func(s *redis.PoolStats) float64 { return float64(s.Timeouts) }},
+	{name: "redis_pool_connections", help: "Number of connections in the pool.", kind: "gauge", value: func(s *redis.PoolStats) float64 { return float64(s.TotalConns) }},
+	{name: "redis_pool_idle_connections", help: "Number of idle connections in the pool.", kind: "gauge", value: func(s *redis.PoolStats) float64 { return float64(s.IdleConns) }},
+	{name: "redis_pool_stale_connections_total", help: "Number of stale connections removed from the pool.", kind: "counter", value: func(s *redis.PoolStats) float64 { return float64(s.StaleConns) }},
+}
+
+type clientSnapshot struct {
+	name     string
+	commands map[string]CommandStats
+	pool     *redis.PoolStats
+}
+
+// WritePrometheus writes the command and pool metrics of every client with
+// metrics enabled in the Prometheus text exposition format, labelled with
+// client="<name>".
+func WritePrometheus(w io.Writer) error {
+	rcm := getRedisClientManagerInstance()
+	rcm.mutex.RLock()
+	configs := make(map[string]*RedisClient, len(rcm.connectionMap))
+	for name, config := range rcm.connectionMap {
+		configs[name] = config
+	}
+	rcm.mutex.RUnlock()
+
+	var clients []clientSnapshot
+	for name, config := range configs {
+		config.stateMutex.Lock()
+		metrics, client := config.metrics, config.client
+		config.stateMutex.Unlock()
+		if metrics == nil {
+			continue
+		}
+		clients = append(clients, clientSnapshot{name: name, commands: metrics.snapshot(), pool: client.PoolStats()})
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].name < clients[j].name })
+
+	if _, err := fmt.Fprint(w, "# HELP redis_command_duration_seconds Latency of redis commands.\n# TYPE redis_command_duration_seconds histogram\n"); err != nil {
+		return err
+	}
+	for _, c := range clients {
+		for _, command := range sortedCommands(c.commands) {
+			stats := c.commands[command]
+			labels := fmt.Sprintf("client=%q,command=%q", c.name, command)
+			var cumulative int64
+			for i, count := range stats.Buckets {
+				cumulative += count
+				le := "+Inf"
+				if i < len(latencyBuckets) {
+					le = fmt.Sprint(latencyBuckets[i].Seconds())
+				}
+				if _, err := fmt.Fprintf(w, "redis_command_duration_seconds_bucket{%s,le=%q} %d\n", labels, le, cumulative); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprintf(w, "redis_command_duration_seconds_sum{%s} %v\nredis_command_duration_seconds_count{%s} %d\n",
+				labels, stats.Total.Seconds(), labels, stats.Calls); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := fmt.Fprint(w, "# HELP redis_command_errors_total Number of redis commands that failed.\n# TYPE redis_command_errors_total counter\n"); err != nil {
+		return err
+	}
+	for _, c := range clients {
+		for _, command := range sortedCommands(c.commands) {
+			if _, err := fmt.Fprintf(w, "redis_command_errors_total{client=%q,command=%q} %d\n", c.name, command, c.commands[command].Errors); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, metric := range poolMetrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", metric.name, metric.help, metric.name, metric.kind); err != nil {
+			return err
+		}
+		for _, c := range clients {
+			if _, err := fmt.Fprintf(w, "%s{client=%q} %v\n", metric.name, c.name, metric.value(c.pool)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func sortedCommands(commands map[string]CommandStats) []string {
+	names := make([]string, 0, len(commands))
+	for command := range commands {
+		names = append(names, command)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,151 @@
+package redis
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	redis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+type recordingTracerProvider struct {
+	noop.TracerProvider
+	mutex sync.Mutex
+	spans []*recordedSpan
+}
+
+func (p *recordingTracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return recordingTracer{provider: p}
+}
+
+func (p *recordingTracerProvider) recorded() []*recordedSpan {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]*recordedSpan(nil), p.spans...)
+}
+
+type recordingTracer struct {
+	noop.Tracer
+	provider *recordingTracerProvider
+}
+
+func (t recordingTracer) Start(ctx context.Context, name string, _ ...trace.SpanStartOption) (context.Context, trace.Span) {
+	span := &recordedSpan{name: name}
+	t.provider.mutex.Lock()
+	t.provider.spans = append(t.provider.spans, span)
+	t.provider.mutex.Unlock()
+	return ctx, span
+}
+
+type recordedSpan struct {
+	noop.Span
+	name   string
+	status codes.Code
+	ended  bool
+}
+
+func (s *recordedSpan) SetStatus(code codes.Code, _ string) { s.status = code }
+func (s *recordedSpan) End(...trace.SpanEndOption)          { s.ended = true }
+
+func TestInstrumentation_Metrics(t *testing.T) {
+	mr := miniredis.RunT(t)
+	InitRedis(map[string]*RedisClient{
+		"metrics": {UniversalAddrs: []string{mr.Addr()}, Instrumentation: InstrumentationConfig{Metrics: true}},
+		"plain":   {UniversalAddrs: []string{mr.Addr()}},
+	})
+	t.Cleanup(func() { _ = Close() })
+
+	ctx := context.Background()
+	client := MustGetConnection("metrics")
+	assert.NoError(t, client.Set(ctx, "k", "v", 0).Err())
+	assert.ErrorIs(t, client.Get(ctx, "missing").Err(), redis.Nil)
+	assert.Error(t, client.Incr(ctx, "k").Err())
+	_, err := client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.Get(ctx, "k")
+		p.Get(ctx, "k")
+		return nil
+	})
+	assert.NoError(t, err)
+	_ = MustGetConnection("plain")
+
+	stats, ok := GetCommandStats("metrics")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), stats["set"].Calls)
+	assert.Equal(t, int64(1), stats["get"].Calls)
+	assert.Equal(t, int64(0), stats["get"].Errors, "redis.Nil is not an error")
+	assert.Equal(t, int64(1), stats["incr"].Errors)
+	assert.Equal(t, int64(1), stats["pipeline"].Calls)
+	assert.Len(t, stats["set"].Buckets, len(latencyBuckets)+1)
+
+	_, ok = GetCommandStats("plain")
+	assert.False(t, ok)
+
+	var buf bytes.Buffer
+	assert.NoError(t, WritePrometheus(&buf))
+	out := buf.String()
+	assert.Contains(t, out, `redis_command_duration_seconds_count{client="metrics",command="set"} 1`)
+	assert.Contains(t, out, `redis_command_duration_seconds_bucket{client="metrics",command="set",le="+Inf"} 1`)
+	assert.Contains(t, out, `redis_command_errors_total{client="metrics",command="incr"} 1`)
+	assert.Contains(t, out, `redis_pool_connections{client="metrics"}`)
+	assert.NotContains(t, out, `client="plain"`)
+}
+
+func TestInstrumentation_Tracing(t *testing.T) {
+	provider := &recordingTracerProvider{}
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	mr := miniredis.RunT(t)
+	InitRedis(map[string]*RedisClient{
+		"traced": {UniversalAddrs: []string{mr.Addr()}, Instrumentation: InstrumentationConfig{Tracing: true}},
+	})
+	t.Cleanup(func() { _ = Close() })
+
+	ctx := context.Background()
+	client := MustGetConnection("traced")
+	assert.NoError(t, client.Set(ctx, "k", "v", 0).Err())
+	assert.Error(t, client.Incr(ctx, "k").Err())
+
+	byName := make(map[string]*recordedSpan)
+	for _, span := range provider.recorded() {
+		byName[span.name] = span
+	}
+	assert.Contains(t, byName, "redis.ping")
+	assert.True(t, byName["redis.set"].ended)
+	assert.Equal(t, codes.Unset, byName["redis.set"].status)
+	assert.Equal(t, codes.Error, byName["redis.incr"].status)
+}
+
+func TestInstrumentation_SlowLog(t *testing.T) {
+	var logs bytes.Buffer
+	hlog.SetOutput(&logs)
+	t.Cleanup(func() { hlog.SetOutput(os.Stderr) })
+
+	hook := newInstrumentationHook("slow", "127.0.0.1:6379", InstrumentationConfig{SlowLogMs: 10}, nil)
+	process := hook.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	assert.NoError(t, process(context.Background(), redis.NewStringCmd(context.Background(), "get", "key")))
+	assert.Contains(t, logs.String(), "redis[slow] slow command get key took")
+
+	logs.Reset()
+	fast := hook.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error { return nil })
+	assert.NoError(t, fast(context.Background(), redis.NewStringCmd(context.Background(), "get", "key")))
+	assert.Empty(t, logs.String())
+
+	assert.Equal(t, "get key, set k2", describeCommands([]redis.Cmder{
+		redis.NewStringCmd(context.Background(), "get", "key"),
+		redis.NewStatusCmd(context.Background(), "set", "k2", "secret"),
+	}))
+}
@@ -0,0 +1,283 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	redis "github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultLockPrefix        = "lock:"
+	defaultLockTTL           = 30 * time.Second
+	defaultLockRetryInterval = 50 * time.Millisecond
+	// redis keeps ttls in whole milliseconds and the watchdog ticks at a third
+	minLockTTL = 3 * time.Millisecond
+)
+
+var (
+	ErrLockNotAcquired = errors.New("redis lock is held by another owner")
+	ErrLockNotHeld     = errors.New("redis lock is not held by this owner")
+	ErrInvalidLockTTL  = errors.New("redis lock ttl must be at least 3ms")
+)
+
+// returns {count, token} when acquired, {0, pttl} when held by another owner
+const redisLockAcquireScript = `
+	local owner = redis.call('HGET', KEYS[1], 'owner')
+	if not owner then
+		local token = redis.call('INCR', KEYS[2])
+		redis.call('HSET', KEYS[1], 'owner', ARGV[1], 'count', 1, 'token', token)
+		redis.call('PEXPIRE', KEYS[1], ARGV[2])
+		return {1, token}
+	end
+	if owner == ARGV[1] then
+		local count = redis.call('HINCRBY', KEYS[1], 'count', 1)
+		redis.call('PEXPIRE', KEYS[1], ARGV[2])
+		return {count, tonumber(redis.call('HGET', KEYS[1], 'token'))}
+	end
+	return {0, redis.call('PTTL', KEYS[1])}
+`
+
+// returns the remaining count, -1 when not held by ARGV[1]
+const redisLockReleaseScript = `
+	if redis.call('HGET', KEYS[1], 'owner') ~= ARGV[1] then
+		return -1
+	end
+	local count = redis.call('HINCRBY', KEYS[1], 'count', -1)
+	if count <= 0 then
+		redis.call('DEL', KEYS[1])
+		return 0
+	end
+	return count
+`
+
+// returns 1 when the ttl was extended
+const redisLockRefreshScript = `
+	if redis.call('HGET', KEYS[1], 'owner') ~= ARGV[1] then
+		return 0
+	end
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+`
+
+var (
+	lockAcquireScript = redis.NewScript(redisLockAcquireScript)
+	lockReleaseScript = redis.NewScript(redisLockReleaseScript)
+	lockRefreshScript = redis.NewScript(redisLockRefreshScript)
+)
+
+type LockOption func(*lockOptions)
+
+type lockOptions struct {
+	ttl           time.Duration
+	wait          time.Duration
+	retryInterval time.Duration
+	owner         string
+	watchdog      bool
+}
+
+// WithLockTTL sets how long the lock lives without renewal, default 30s.
+// Acquire rejects ttls under 3ms with ErrInvalidLockTTL.
+func WithLockTTL(ttl time.Duration) LockOption {
+	return func(o *lockOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithLockWait retries for up to wait while the lock is held, by default
+// Acquire fails at once.
+func WithLockWait(wait time.Duration) LockOption {
+	return func(o *lockOptions) {
+		o.wait = wait
+	}
+}
+
+func WithLockRetryInterval(interval time.Duration) LockOption {
+	return func(o *lockOptions) {
+		o.retryInterval = interval
+	}
+}
+
+// WithLockOwner makes the lock reentrant for owner, each Acquire then needs
+// its own Release. Without it every Acquire is a new owner.
+func WithLockOwner(owner string) LockOption {
+	return func(o *lockOptions) {
+		o.owner = owner
+	}
+}
+
+// WithLockWatchdog renews the ttl every third of it until Release.
+func WithLockWatchdog() LockOption {
+	return func(o *lockOptions) {
+		o.watchdog = true
+	}
+}
+
+type Locker struct {
+	rdb    redis.UniversalClient
+	prefix string
+}
+
+// NewLocker stores locks under prefix, default "lock:". The name is wrapped
+// in a hash tag so the lock and its fencing counter share a cluster slot.
+func NewLocker(rdb redis.UniversalClient, prefix string) *Locker {
+	if prefix == "" {
+		prefix = defaultLockPrefix
+	}
+	return &Locker{rdb: rdb, prefix: prefix}
+}
+
+type Lock struct {
+	rdb   redis.UniversalClient
+	key   string
+	owner string
+	ttl   time.Duration
+	token int64
+
+	releaseOnce sync.Once
+	stop        chan struct{}
+	lost        chan struct{}
+	lostOnce    sync.Once
+}
+
+// Acquire takes the lock name or returns ErrLockNotAcquired once the wait
+// is over.
+func (l *Locker) Acquire(ctx context.Context, name string, opts ...LockOption) (*Lock, error) {
+	o := lockOptions{ttl: defaultLockTTL, retryInterval: defaultLockRetryInterval}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.ttl < minLockTTL {
+		return nil, ErrInvalidLockTTL
+	}
+	if o.owner == "" {
+		owner, err := randomOwner()
+		if err != nil {
+			return nil, err
+		}
+		o.owner = owner
+	}
+
+	key := l.prefix + "{" + name + "}"
+	keys := []string{key, key + ":fence"}
+	deadline := time.Now().Add(o.wait)
+	for {
+		result, err := lockAcquireScript.Run(ctx, l.rdb, keys, o.owner, o.ttl.Milliseconds()).Int64Slice()
+		if err != nil {
+			return nil, err
+		}
+		if result[0] > 0 {
+			lock := &Lock{
+				rdb:   l.rdb,
+				key:   key,
+				owner: o.owner,
+				ttl:   o.ttl,
+				token: result[1],
+				stop:  make(chan struct{}),
+				lost:  make(chan struct{}),
+			}
+			if o.watchdog {
+				go lock.watchdog()
+			}
+			return lock, nil
+		}
+
+		sleep := min(o.retryInterval, time.Duration(result[1])*time.Millisecond)
+		if sleep <= 0 {
+			sleep = o.retryInterval
+		}
+		if time.Now().Add(sleep).After(deadline) {
+			return nil, ErrLockNotAcquired
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(sleep):
+		}
+	}
+}
+
+// Token is the fencing token, it increases with every new owner of the lock.
+// Pass it to the protected resource so writes of an expired owner can be
+// rejected.
+func (lk *Lock) Token() int64 {
+	return lk.token
+}
+
+func (lk *Lock) Owner() string {
+	return lk.owner
+}
+
+// Lost is closed when the watchdog finds the lock taken over or expired.
+func (lk *Lock) Lost() <-chan struct{} {
+	return lk.lost
+}
+
+// Refresh extends the ttl, it fails with ErrLockNotHeld after expiry.
+func (lk *Lock) Refresh(ctx context.Context) error {
+	ok, err := lockRefreshScript.Run(ctx, lk.rdb, []string{lk.key}, lk.owner, lk.ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Release gives up this acquisition, the lock is deleted when the owner has
+// released every reentrant Acquire. Further calls are no-ops.
+func (lk *Lock) Release(ctx context.Context) error {
+	err := ErrLockNotHeld
+	released := false
+	lk.releaseOnce.Do(func() {
+		released = true
+		close(lk.stop)
+
+		var remaining int
+		remaining, err = lockReleaseScript.Run(ctx, lk.rdb, []string{lk.key}, lk.owner).Int()
+		if err == nil && remaining < 0 {
+			err = ErrLockNotHeld
+		}
+	})
+	if !released {
+		return nil
+	}
+	return err
+}
+
+func (lk *Lock) watchdog() {
+	ticker := time.NewTicker(lk.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lk.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), lk.ttl/3)
+			err := lk.Refresh(ctx)
+			cancel()
+			if errors.Is(err, ErrLockNotHeld) {
+				hlog.Warnf("redis lock %s lost by %s", lk.key, lk.owner)
+				lk.lostOnce.Do(func() { close(lk.lost) })
+				return
+			}
+			if err != nil {
+				hlog.Warnf("redis lock %s renew failed: %v", lk.key, err)
+			}
+		}
+	}
+}
+
+func randomOwner() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,170 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(t *testing.T) (*miniredis.Miniredis, redis.UniversalClient) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return mr, rdb
+}
+
+func TestLock_Exclusive(t *testing.T) {
+	mr, rdb := newTestClient(t)
+	locker := NewLocker(rdb, "")
+	ctx := context.Background()
+
+	lock, err := locker.Acquire(ctx, "job")
+	assert.NoError(t, err)
+	assert.True(t, mr.Exists("lock:{job}"))
+
+	_, err = locker.Acquire(ctx, "job")
+	assert.ErrorIs(t, err, ErrLockNotAcquired)
+
+	start := time.Now()
+	_, err = locker.Acquire(ctx, "job", WithLockWait(100*time.Millisecond), WithLockRetryInterval(20*time.Millisecond))
+	assert.ErrorIs(t, err, ErrLockNotAcquired)
+	assert.GreaterOrEqual(t, time.Since(start), 80*time.Millisecond)
+
+	assert.NoError(t, lock.Release(ctx))
+	assert.NoError(t, lock.Release(ctx))
+	assert.False(t, mr.Exists("lock:{job}"))
+
+	other, err := locker.Acquire(ctx, "job")
+	assert.NoError(t, err)
+	assert.Greater(t, other.Token(), lock.Token())
+}
+
+func TestLock_RejectsShortTTL(t *testing.T) {
+	mr, rdb := newTestClient(t)
+	locker := NewLocker(rdb, "")
+	ctx := context.Background()
+
+	for _, ttl := range []time.Duration{0, 500 * time.Microsecond, 2 * time.Millisecond} {
+		_, err := locker.Acquire(ctx, "job", WithLockTTL(ttl), WithLockWatchdog())
+		assert.ErrorIs(t, err, ErrInvalidLockTTL)
+	}
+	assert.False(t, mr.Exists("lock:{job}:fence"), "Rejected ttls should not touch redis")
+
+	lock, err := locker.Acquire(ctx, "job", WithLockTTL(3*time.Millisecond), WithLockWatchdog())
+	assert.NoError(t, err)
+	assert.NoError(t, lock.Release(ctx))
+}
+
+func TestLock_WaitForRelease(t *testing.T) {
+	_, rdb := newTestClient(t)
+	locker := NewLocker(rdb, "")
+	ctx := context.Background()
+
+	lock, err := locker.Acquire(ctx, "job")
+	assert.NoError(t, err)
+	time.AfterFunc(50*time.Millisecond, func() { _ = lock.Release(ctx) })
+
+	next, err := locker.Acquire(ctx, "job", WithLockWait(time.Second), WithLockRetryInterval(10*time.Millisecond))
+	assert.NoError(t, err)
+	assert.Equal(t, lock.Token()+1, next.Token())
+}
+
+func TestLock_OnlyOwnerReleases(t *testing.T) {
+	mr, rdb := newTestClient(t)
+	locker := NewLocker(rdb, "")
+	ctx := context.Background()
+
+	lock, err := locker.Acquire(ctx, "job", WithLockTTL(time.Second))
+	assert.NoError(t, err)
+
+	// expired and taken by someone else
+	mr.FastForward(2 * time.Second)
+	other, err := locker.Acquire(ctx, "job")
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, lock.Refresh(ctx), ErrLockNotHeld)
+	assert.ErrorIs(t, lock.Release(ctx), ErrLockNotHeld)
+	assert.Equal(t, other.Owner(), mr.HGet("lock:{job}", "owner"))
+}
+
+func TestLock_Reentrant(t *testing.T) {
+	mr, rdb := newTestClient(t)
+	locker := NewLocker(rdb, "")
+	ctx := context.Background()
+
+	outer, err := locker.Acquire(ctx, "job", WithLockOwner("worker-1"))
+	assert.NoError(t, err)
+	inner, err := locker.Acquire(ctx, "job", WithLockOwner("worker-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, outer.Token(), inner.Token())
+
+	_, err = locker.Acquire(ctx, "job", WithLockOwner("worker-2"))
+	assert.ErrorIs(t, err, ErrLockNotAcquired)
+
+	assert.NoError(t, inner.Release(ctx))
+	assert.True(t, mr.Exists("lock:{job}"))
+	assert.NoError(t, outer.Release(ctx))
+	assert.False(t, mr.Exists("lock:{job}"))
+}
+
+func TestLock_Watchdog(t *testing.T) {
+	mr, rdb := newTestClient(t)
+	locker := NewLocker(rdb, "")
+	ctx := context.Background()
+
+	lock, err := locker.Acquire(ctx, "job", WithLockTTL(300*time.Millisecond), WithLockWatchdog())
+	assert.NoError(t, err)
+
+	// miniredis only moves its clock on FastForward, the watchdog resets
+	// the ttl in between
+	for i := 0; i < 3; i++ {
+		mr.FastForward(200 * time.Millisecond)
+		time.Sleep(150 * time.Millisecond)
+	}
+	assert.True(t, mr.Exists("lock:{job}"))
+
+	mr.Del("lock:{job}")
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lost lock not reported")
+	}
+	assert.ErrorIs(t, lock.Release(ctx), ErrLockNotHeld)
+}
+
+func TestLock_Concurrent(t *testing.T) {
+	_, rdb := newTestClient(t)
+	locker := NewLocker(rdb, "")
+	ctx := context.Background()
+
+	var mutex sync.Mutex
+	var tokens []int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lock, err := locker.Acquire(ctx, "job", WithLockWait(5*time.Second), WithLockRetryInterval(5*time.Millisecond))
+			if !assert.NoError(t, err) {
+				return
+			}
+			mutex.Lock()
+			tokens = append(tokens, lock.Token())
+			mutex.Unlock()
+			assert.NoError(t, lock.Release(ctx))
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, tokens, 8)
+	seen := map[int64]bool{}
+	for _, token := range tokens {
+		assert.False(t, seen[token])
+		seen[token] = true
+	}
+}
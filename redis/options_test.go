@@ -0,0 +1,145 @@
+package redis
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptions(t *testing.T) {
+	sentinel := &RedisClient{
+		UniversalAddrs:   []string{"s1:26379", "s2:26379"},
+		MasterName:       "mymaster",
+		DB:               3,
+		Username:         "app",
+		Password:         "pw",
+		SentinelUsername: "sentinel",
+		SentinelPassword: "spw",
+		DialTimeoutMs:    1500,
+		ReadTimeoutMs:    200,
+		WriteTimeoutMs:   300,
+		MinIdleConns:     4,
+		MaxRetries:       -1,
+		ClientName:       "svc",
+	}
+	options, err := sentinel.options()
+	assert.NoError(t, err)
+	// db used to be dropped for sentinel
+	assert.Equal(t, 3, options.DB)
+	assert.Equal(t, "app", options.Username)
+	assert.Equal(t, "sentinel", options.SentinelUsername)
+	assert.Equal(t, "spw", options.SentinelPassword)
+	assert.Equal(t, 1500*time.Millisecond, options.DialTimeout)
+	assert.Equal(t, 200*time.Millisecond, options.ReadTimeout)
+	assert.Equal(t, 300*time.Millisecond, options.WriteTimeout)
+	assert.Equal(t, 4, options.MinIdleConns)
+	assert.Equal(t, -1, options.MaxRetries)
+	assert.Equal(t, "svc", options.ClientName)
+	assert.Nil(t, options.TLSConfig)
+
+	cluster := &RedisClient{
+		UniversalAddrs: []string{"n1:6379", "n2:6379"},
+		RouteByLatency: true,
+	}
+	options, err = cluster.options()
+	assert.NoError(t, err)
+	assert.True(t, options.RouteByLatency)
+
+	cluster.DB = 1
+	_, err = cluster.options()
+	assert.ErrorIs(t, err, ErrClusterDB)
+}
+
+func TestConnect_BadConfig(t *testing.T) {
+	InitRedis(map[string]*RedisClient{
+		"cluster": {UniversalAddrs: []string{"n1:6379", "n2:6379"}, DB: 2},
+		"tls":     {UniversalAddrs: []string{"127.0.0.1:1"}, TLS: TLSConfig{Enable: true, CAFile: "missing.pem"}},
+	})
+	t.Cleanup(func() { _ = Close() })
+
+	_, err := GetConnectionE("cluster")
+	assert.ErrorIs(t, err, ErrClusterDB)
+	_, err = GetConnectionE("tls")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	status, err := HealthCheck(context.Background(), "tls")
+	assert.NoError(t, err)
+	assert.False(t, status.Healthy)
+}
+
+func TestConnect_ACL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.RequireUserAuth("app", "secret")
+
+	InitRedis(map[string]*RedisClient{
+		"acl":   {UniversalAddrs: []string{mr.Addr()}, Username: "app", Password: "secret"},
+		"wrong": {UniversalAddrs: []string{mr.Addr()}, Username: "app", Password: "nope"},
+	})
+	t.Cleanup(func() { _ = Close() })
+
+	client, err := GetConnectionE("acl")
+	assert.NoError(t, err)
+	assert.NoError(t, client.Ping(context.Background()).Err())
+
+	_, err = GetConnectionE("wrong")
+	assert.Error(t, err)
+}
+
+func writeTestCert(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "redis-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	config, err := TLSConfig{}.load()
+	assert.NoError(t, err)
+	assert.Nil(t, config)
+
+	certFile, keyFile := writeTestCert(t, t.TempDir())
+	config, err = TLSConfig{
+		Enable:     true,
+		CAFile:     certFile,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		ServerName: "redis.internal",
+	}.load()
+	assert.NoError(t, err)
+	assert.NotNil(t, config.RootCAs)
+	assert.Len(t, config.Certificates, 1)
+	assert.Equal(t, "redis.internal", config.ServerName)
+
+	_, err = TLSConfig{Enable: true, CAFile: keyFile}.load()
+	assert.Error(t, err)
+	_, err = TLSConfig{Enable: true, CertFile: certFile}.load()
+	assert.Error(t, err)
+}
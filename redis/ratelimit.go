@@ -0,0 +1,275 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+const defaultRateLimitPrefix = "ratelimit:"
+
+var (
+	ErrInvalidRateLimit  = errors.New("rate limit and window must be positive")
+	ErrInvalidRateLimitN = errors.New("rate limit n must be positive")
+)
+
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int           // requests left right now
+	RetryAfter time.Duration // wait before the next request is allowed, zero when allowed
+}
+
+type Limiter interface {
+	Allow(ctx context.Context, key string) (RateLimitResult, error)
+	// AllowN takes n requests at once, all or nothing.
+	AllowN(ctx context.Context, key string, n int) (RateLimitResult, error)
+}
+
+type LimiterOption func(*limiterOptions)
+
+type limiterOptions struct {
+	prefix string
+	now    func() time.Time
+}
+
+// WithLimiterPrefix replaces "ratelimit:" in front of the keys.
+func WithLimiterPrefix(prefix string) LimiterOption {
+	return func(o *limiterOptions) {
+		o.prefix = prefix
+	}
+}
+
+// WithLimiterClock replaces time.Now. The time is sent to redis with each
+// call, so the clocks of the app servers should agree.
+func WithLimiterClock(now func() time.Time) LimiterOption {
+	return func(o *limiterOptions) {
+		o.now = now
+	}
+}
+
+func newLimiterOptions(opts []LimiterOption) limiterOptions {
+	o := limiterOptions{prefix: defaultRateLimitPrefix, now: time.Now}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// key wraps the user key in a hash tag so every key of one limiter call
+// lands in the same cluster slot.
+func (o limiterOptions) key(key string) string {
+	return o.prefix + "{" + key + "}"
+}
+
+func toResult(values []int64) RateLimitResult {
+	return RateLimitResult{
+		Allowed:    values[0] == 1,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+	}
+}
+
+// {allowed, remaining, retry after ms}
+const redisSlidingLogScript = `
+	local key = KEYS[1]
+	local now = tonumber(ARGV[1])
+	local window = tonumber(ARGV[2])
+	local limit = tonumber(ARGV[3])
+	local n = tonumber(ARGV[4])
+	local member = ARGV[5]
+
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+	local count = redis.call('ZCARD', key)
+	if count + n > limit then
+		local retry = window
+		local oldest = redis.call('ZRANGE', key, count + n - limit - 1, count + n - limit - 1, 'WITHSCORES')
+		if oldest[2] then
+			retry = tonumber(oldest[2]) + window - now
+		end
+		return {0, math.max(limit - count, 0), math.max(retry, 1)}
+	end
+	for i = 1, n do
+		redis.call('ZADD', key, now, member .. ':' .. i)
+	end
+	redis.call('PEXPIRE', key, window)
+	return {1, limit - count - n, 0}
+`
+
+type slidingLogLimiter struct {
+	rdb     redis.UniversalClient
+	limit   int
+	window  time.Duration
+	options limiterOptions
+}
+
+// NewSlidingWindowLogLimiter keeps a timestamp per request, exact but with
+// memory proportional to limit.
+func NewSlidingWindowLogLimiter(rdb redis.UniversalClient, limit int, window time.Duration, opts ...LimiterOption) (Limiter, error) {
+	if limit <= 0 || window < time.Millisecond {
+		return nil, ErrInvalidRateLimit
+	}
+	return &slidingLogLimiter{rdb: rdb, limit: limit, window: window, options: newLimiterOptions(opts)}, nil
+}
+
+func (l *slidingLogLimiter) Allow(ctx context.Context, key string) (RateLimitResult, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+func (l *slidingLogLimiter) AllowN(ctx context.Context, key string, n int) (RateLimitResult, error) {
+	if n <= 0 {
+		return RateLimitResult{}, ErrInvalidRateLimitN
+	}
+	member, err := randomMember()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	values, err := slidingLogScript.Run(ctx, l.rdb, []string{l.options.key(key)},
+		l.options.now().UnixMilli(), l.window.Milliseconds(), l.limit, n, member).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return toResult(values), nil
+}
+
+// {allowed, remaining, retry after ms}, the previous window is weighted by
+// how much of it still overlaps the sliding window
+const redisSlidingCounterScript = `
+	local now = tonumber(ARGV[1])
+	local window = tonumber(ARGV[2])
+	local limit = tonumber(ARGV[3])
+	local n = tonumber(ARGV[4])
+
+	local elapsed = now % window
+	local prev = tonumber(redis.call('GET', KEYS[1])) or 0
+	local curr = tonumber(redis.call('GET', KEYS[2])) or 0
+	local weight = (window - elapsed) / window
+	local estimated = prev * weight + curr
+
+	if estimated + n > limit then
+		local retry = window - elapsed
+		if curr + n <= limit and prev > 0 then
+			-- the weight of prev has to drop to (limit - n - curr) / prev
+			local target = (limit - n - curr) / prev
+			retry = math.ceil((1 - target) * window - elapsed)
+		end
+		return {0, math.max(math.floor(limit - estimated), 0), math.max(retry, 1)}
+	end
+	redis.call('INCRBY', KEYS[2], n)
+	redis.call('PEXPIRE', KEYS[2], window * 2)
+	return {1, math.max(math.floor(limit - estimated - n), 0), 0}
+`
+
+type slidingCounterLimiter struct {
+	rdb     redis.UniversalClient
+	limit   int
+	window  time.Duration
+	options limiterOptions
+}
+
+// NewSlidingWindowCounterLimiter approximates a sliding window with two
+// fixed window counters, constant memory per key.
+func NewSlidingWindowCounterLimiter(rdb redis.UniversalClient, limit int, window time.Duration, opts ...LimiterOption) (Limiter, error) {
+	if limit <= 0 || window < time.Millisecond {
+		return nil, ErrInvalidRateLimit
+	}
+	return &slidingCounterLimiter{rdb: rdb, limit: limit, window: window, options: newLimiterOptions(opts)}, nil
+}
+
+func (l *slidingCounterLimiter) Allow(ctx context.Context, key string) (RateLimitResult, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+func (l *slidingCounterLimiter) AllowN(ctx context.Context, key string, n int) (RateLimitResult, error) {
+	if n <= 0 {
+		return RateLimitResult{}, ErrInvalidRateLimitN
+	}
+	now := l.options.now().UnixMilli()
+	window := l.window.Milliseconds()
+	index := now / window
+	base := l.options.key(key) + ":"
+	keys := []string{base + strconv.FormatInt(index-1, 10), base + strconv.FormatInt(index, 10)}
+
+	values, err := slidingCounterScript.Run(ctx, l.rdb, keys, now, window, l.limit, n).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return toResult(values), nil
+}
+
+// {allowed, remaining, retry after ms}, tat is the theoretical arrival time
+const redisGCRAScript = `
+	local now = tonumber(ARGV[1])
+	local interval = tonumber(ARGV[2])
+	local burst = tonumber(ARGV[3])
+	local n = tonumber(ARGV[4])
+
+	local tat = tonumber(redis.call('GET', KEYS[1])) or now
+	tat = math.max(tat, now)
+	local newTat = tat + interval * n
+	local allowAt = newTat - interval * burst
+	if now < allowAt then
+		local remaining = math.floor((now - (tat - interval * burst)) / interval)
+		return {0, math.max(remaining, 0), math.ceil(allowAt - now)}
+	end
+	redis.call('SET', KEYS[1], newTat, 'PX', math.ceil(newTat - now))
+	return {1, math.floor((now - allowAt) / interval), 0}
+`
+
+type gcraLimiter struct {
+	rdb      redis.UniversalClient
+	interval float64 // ms between requests at the sustained rate
+	burst    int
+	options  limiterOptions
+}
+
+// NewGCRALimiter is a token bucket refilled with rate tokens per period and
+// holding up to burst tokens, stored as a single timestamp per key.
+func NewGCRALimiter(rdb redis.UniversalClient, rate int, period time.Duration, burst int, opts ...LimiterOption) (Limiter, error) {
+	if rate <= 0 || period < time.Millisecond {
+		return nil, ErrInvalidRateLimit
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	return &gcraLimiter{
+		rdb:      rdb,
+		interval: float64(period.Milliseconds()) / float64(rate),
+		burst:    burst,
+		options:  newLimiterOptions(opts),
+	}, nil
+}
+
+func (l *gcraLimiter) Allow(ctx context.Context, key string) (RateLimitResult, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+func (l *gcraLimiter) AllowN(ctx context.Context, key string, n int) (RateLimitResult, error) {
+	if n <= 0 {
+		return RateLimitResult{}, ErrInvalidRateLimitN
+	}
+	values, err := gcraScript.Run(ctx, l.rdb, []string{l.options.key(key)},
+		l.options.now().UnixMilli(), l.interval, l.burst, n).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return toResult(values), nil
+}
+
+var (
+	slidingLogScript     = redis.NewScript(redisSlidingLogScript)
+	slidingCounterScript = redis.NewScript(redisSlidingCounterScript)
+	gcraScript           = redis.NewScript(redisGCRAScript)
+)
+
+func randomMember() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,97 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// KeyFunc picks the rate limit key of a request, an empty key skips limiting.
+type KeyFunc func(ctx context.Context, c *app.RequestContext) string
+
+// KeyByIP limits by the address of the peer connection. Forwarding headers
+// are ignored since any client can set them, behind a proxy use KeyByClientIP.
+func KeyByIP(ctx context.Context, c *app.RequestContext) string {
+	return "ip:" + remoteIP(c)
+}
+
+// KeyByClientIP limits by c.ClientIP(), which reads X-Forwarded-For and
+// X-Real-IP. Only use it when the engine trusts just the proxies in front of
+// it, e.g. through app.SetClientIPFunc with ClientIPOptions.TrustedCIDRs, as
+// hertz trusts every peer by default.
+func KeyByClientIP(ctx context.Context, c *app.RequestContext) string {
+	return "ip:" + c.ClientIP()
+}
+
+func remoteIP(c *app.RequestContext) string {
+	addr := c.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// KeyByRoute limits the route pattern, e.g. /users/:id, across all callers.
+func KeyByRoute(ctx context.Context, c *app.RequestContext) string {
+	return "route:" + c.FullPath()
+}
+
+// KeyByUser limits by the value an earlier middleware stored under
+// contextKey, falling back to the client ip for anonymous requests.
+func KeyByUser(contextKey string) KeyFunc {
+	return func(ctx context.Context, c *app.RequestContext) string {
+		if user, ok := c.Get(contextKey); ok && user != nil {
+			if s := fmt.Sprint(user); s != "" {
+				return "user:" + s
+			}
+		}
+		return KeyByIP(ctx, c)
+	}
+}
+
+// KeyByRouteAndIP limits each peer address per route, like KeyByIP.
+func KeyByRouteAndIP(ctx context.Context, c *app.RequestContext) string {
+	return "route:" + c.FullPath() + ":ip:" + remoteIP(c)
+}
+
+type RateLimitResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// RateLimitMiddleware answers 429 with a Retry-After header once keyFunc's
+// key is over the limit. Requests pass when redis fails.
+func RateLimitMiddleware(limiter Limiter, keyFunc KeyFunc) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		key := keyFunc(ctx, c)
+		if key == "" {
+			c.Next(ctx)
+			return
+		}
+
+		result, err := limiter.Allow(ctx, key)
+		if err != nil {
+			hlog.CtxWarnf(ctx, "rate limit %s failed, letting the request pass: %v", key, err)
+			c.Next(ctx)
+			return
+		}
+
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		if !result.Allowed {
+			retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, RateLimitResponse{
+				Code:    "rate_limited",
+				Message: "too many requests",
+			})
+			return
+		}
+		c.Next(ctx)
+	}
+}
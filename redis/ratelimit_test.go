@@ -0,0 +1,205 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/stretchr/testify/assert"
+)
+
+type testClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestSlidingWindowLogLimiter(t *testing.T) {
+	_, rdb := newTestClient(t)
+	clock := &testClock{now: time.UnixMilli(1700000000000)}
+	limiter, err := NewSlidingWindowLogLimiter(rdb, 3, time.Second, WithLimiterClock(clock.Now))
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	for i := 2; i >= 0; i-- {
+		result, err := limiter.Allow(ctx, "k")
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, i, result.Remaining)
+		clock.Advance(100 * time.Millisecond)
+	}
+
+	// the first request leaves the window 1s after it was made
+	result, err := limiter.Allow(ctx, "k")
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 700*time.Millisecond, result.RetryAfter)
+
+	clock.Advance(700 * time.Millisecond)
+	result, err = limiter.Allow(ctx, "k")
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	result, err = limiter.AllowN(ctx, "k", 2)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	result, err = limiter.Allow(ctx, "other")
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+}
+
+func TestSlidingWindowCounterLimiter(t *testing.T) {
+	_, rdb := newTestClient(t)
+	clock := &testClock{now: time.UnixMilli(1700000000000)}
+	limiter, err := NewSlidingWindowCounterLimiter(rdb, 10, time.Second, WithLimiterClock(clock.Now))
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	result, err := limiter.AllowN(ctx, "k", 10)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	result, err = limiter.Allow(ctx, "k")
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+
+	// half way into the next window the previous one counts half
+	clock.Advance(1500 * time.Millisecond)
+	result, err = limiter.AllowN(ctx, "k", 5)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	result, err = limiter.Allow(ctx, "k")
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	// prev weight has to drop from 0.5 to 0.4
+	assert.Equal(t, 100*time.Millisecond, result.RetryAfter)
+
+	clock.Advance(100 * time.Millisecond)
+	result, err = limiter.Allow(ctx, "k")
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+}
+
+func TestGCRALimiter(t *testing.T) {
+	_, rdb := newTestClient(t)
+	clock := &testClock{now: time.UnixMilli(1700000000000)}
+	// 10 per second sustained, bursts of 5
+	limiter, err := NewGCRALimiter(rdb, 10, time.Second, 5, WithLimiterClock(clock.Now))
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	for i := 4; i >= 0; i-- {
+		result, err := limiter.Allow(ctx, "k")
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, i, result.Remaining)
+	}
+	result, err := limiter.Allow(ctx, "k")
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 100*time.Millisecond, result.RetryAfter)
+
+	clock.Advance(100 * time.Millisecond)
+	result, err = limiter.Allow(ctx, "k")
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	// the bucket refills completely after burst/rate
+	clock.Advance(time.Second)
+	result, err = limiter.AllowN(ctx, "k", 5)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	result, err = limiter.AllowN(ctx, "k", 6)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+
+	_, err = NewGCRALimiter(rdb, 0, time.Second, 1)
+	assert.ErrorIs(t, err, ErrInvalidRateLimit)
+}
+
+func TestLimiterRejectsNonPositiveN(t *testing.T) {
+	_, rdb := newTestClient(t)
+	logLimiter, err := NewSlidingWindowLogLimiter(rdb, 3, time.Second)
+	assert.NoError(t, err)
+	counterLimiter, err := NewSlidingWindowCounterLimiter(rdb, 3, time.Second)
+	assert.NoError(t, err)
+	gcraLimiter, err := NewGCRALimiter(rdb, 3, time.Second, 3)
+	assert.NoError(t, err)
+
+	for _, limiter := range []Limiter{logLimiter, counterLimiter, gcraLimiter} {
+		for _, n := range []int{0, -5} {
+			_, err := limiter.AllowN(context.Background(), "k", n)
+			assert.ErrorIs(t, err, ErrInvalidRateLimitN)
+		}
+		// a rejected negative n must not hand out extra capacity
+		result, err := limiter.AllowN(context.Background(), "k", 4)
+		assert.NoError(t, err)
+		assert.False(t, result.Allowed)
+	}
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, key string) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("redis down")
+}
+
+func (failingLimiter) AllowN(ctx context.Context, key string, n int) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("redis down")
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	_, rdb := newTestClient(t)
+	limiter, err := NewSlidingWindowLogLimiter(rdb, 2, time.Minute)
+	assert.NoError(t, err)
+
+	engine := route.NewEngine(config.NewOptions(nil))
+	ok := func(ctx context.Context, c *app.RequestContext) { c.String(http.StatusOK, "ok") }
+	engine.GET("/ip", RateLimitMiddleware(limiter, KeyByIP), ok)
+	engine.GET("/user", func(ctx context.Context, c *app.RequestContext) {
+		c.Set("user_id", string(c.GetHeader("X-User")))
+		c.Next(ctx)
+	}, RateLimitMiddleware(limiter, KeyByUser("user_id")), ok)
+	engine.GET("/broken", RateLimitMiddleware(failingLimiter{}, KeyByRoute), ok)
+
+	for i := 0; i < 2; i++ {
+		w := ut.PerformRequest(engine, http.MethodGet, "/ip", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	// a forged forwarding header does not get a fresh budget
+	w := ut.PerformRequest(engine, http.MethodGet, "/ip", nil, ut.Header{Key: "X-Forwarded-For", Value: "10.0.0.1"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	w = ut.PerformRequest(engine, http.MethodGet, "/ip", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+
+	// users have their own budget
+	w = ut.PerformRequest(engine, http.MethodGet, "/user", nil, ut.Header{Key: "X-User", Value: "42"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+
+	w = ut.PerformRequest(engine, http.MethodGet, "/broken", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
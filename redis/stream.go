@@ -0,0 +1,313 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	redis "github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultStreamBatchSize     = 10
+	DefaultStreamBlock         = 2 * time.Second
+	DefaultStreamRetryCount    = 3
+	DefaultStreamClaimIdle     = 30 * time.Second
+	DefaultStreamClaimInterval = 10 * time.Second
+
+	streamBodyField = "body"
+)
+
+var ErrInvalidStreamConf = errors.New("redis stream and group are required")
+
+type StreamProducerConf struct {
+	Stream string `yaml:"stream"`  // stream key
+	MaxLen int64  `yaml:"max_len"` // approximate cap on the stream length, 0 keeps every entry
+}
+
+type StreamConsumerConf struct {
+	Stream           string `yaml:"stream"`             // stream key
+	Group            string `yaml:"group"`              // consumer group, created when missing
+	Consumer         string `yaml:"consumer"`           // unique per process, default hostname-pid
+	BatchSize        int64  `yaml:"batch_size"`         // entries per read
+	BlockMs          int    `yaml:"block_ms"`           // how long a read waits for new entries
+	RetryCount       int    `yaml:"retry_count"`        // redeliveries before an entry is dead-lettered
+	ClaimIdleMs      int    `yaml:"claim_idle_ms"`      // pending entries idle this long are reclaimed, also the retry delay
+	ClaimIntervalMs  int    `yaml:"claim_interval_ms"`  // how often pending entries are checked
+	DeadLetterStream string `yaml:"dead_letter_stream"` // default <stream>:dead
+	FromBeginning    bool   `yaml:"from_beginning"`     // a new group starts at the first entry instead of new ones
+}
+
+type StreamProducer struct {
+	rdb    redis.UniversalClient
+	config *StreamProducerConf
+}
+
+func NewStreamProducer(rdb redis.UniversalClient, conf *StreamProducerConf) (*StreamProducer, error) {
+	if conf.Stream == "" {
+		return nil, ErrInvalidStreamConf
+	}
+	return &StreamProducer{rdb: rdb, config: conf}, nil
+}
+
+func (p *StreamProducer) Publish(message []byte) error {
+	return p.PublishCtx(context.Background(), message)
+}
+
+func (p *StreamProducer) PublishCtx(ctx context.Context, message []byte) error {
+	return p.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: p.config.Stream,
+		MaxLen: p.config.MaxLen,
+		Approx: p.config.MaxLen > 0,
+		Values: []interface{}{streamBodyField, message},
+	}).Err()
+}
+
+// StreamConsumer reads a stream as one member of a consumer group. Entries
+// are acked once the handler succeeds. A failed entry stays pending and is
+// retried when it is reclaimed after claim_idle_ms, which also picks up the
+// entries of consumers that died. An entry delivered more than retry_count
+// times is moved to the dead-letter stream.
+type StreamConsumer struct {
+	rdb     redis.UniversalClient
+	config  *StreamConsumerConf
+	handler func([]byte) error
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// NewStreamConsumer fills in the defaults and creates the group, and the
+// stream with it, when missing.
+func NewStreamConsumer(rdb redis.UniversalClient, conf *StreamConsumerConf) (*StreamConsumer, error) {
+	if conf.Stream == "" || conf.Group == "" {
+		return nil, ErrInvalidStreamConf
+	}
+	if conf.Consumer == "" {
+		hostname, _ := os.Hostname()
+		conf.Consumer = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = DefaultStreamBatchSize
+	}
+	if conf.BlockMs <= 0 {
+		conf.BlockMs = int(DefaultStreamBlock.Milliseconds())
+	}
+	if conf.RetryCount <= 0 {
+		conf.RetryCount = DefaultStreamRetryCount
+	}
+	if conf.ClaimIdleMs <= 0 {
+		conf.ClaimIdleMs = int(DefaultStreamClaimIdle.Milliseconds())
+	}
+	if conf.ClaimIntervalMs <= 0 {
+		conf.ClaimIntervalMs = int(DefaultStreamClaimInterval.Milliseconds())
+	}
+	if conf.DeadLetterStream == "" {
+		conf.DeadLetterStream = conf.Stream + ":dead"
+	}
+
+	c := &StreamConsumer{rdb: rdb, config: conf}
+	if err := c.createGroup(context.Background()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *StreamConsumer) createGroup(ctx context.Context) error {
+	start := "$"
+	if c.config.FromBeginning {
+		start = "0"
+	}
+	err := c.rdb.XGroupCreateMkStream(ctx, c.config.Stream, c.config.Group, start).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create group %s on %s: %w", c.config.Group, c.config.Stream, err)
+	}
+	return nil
+}
+
+// Start consumes in the background. The handler is never called
+// concurrently by one consumer.
+func (c *StreamConsumer) Start(handler func([]byte) error) error {
+	c.handler = handler
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.stopped = make(chan struct{})
+	go c.consume()
+	return nil
+}
+
+// Stop waits for the entry in hand, unacked entries are reclaimed later by
+// the rest of the group.
+func (c *StreamConsumer) Stop() {
+	c.stopOnce.Do(func() {
+		if c.cancel == nil {
+			return
+		}
+		c.cancel()
+		<-c.stopped
+	})
+}
+
+func (c *StreamConsumer) consume() {
+	defer close(c.stopped)
+
+	claimInterval := time.Duration(c.config.ClaimIntervalMs) * time.Millisecond
+	var lastClaim time.Time
+	for c.ctx.Err() == nil {
+		var err error
+		if time.Since(lastClaim) >= claimInterval {
+			lastClaim = time.Now()
+			err = c.claim()
+		}
+		if err == nil {
+			err = c.read()
+		}
+		if err == nil || c.ctx.Err() != nil {
+			continue
+		}
+
+		hlog.Errorf("redis stream %s consume failed: %v", c.config.Stream, err)
+		if strings.HasPrefix(err.Error(), "NOGROUP") {
+			// the stream was deleted together with its groups
+			if err := c.createGroup(c.ctx); err != nil {
+				hlog.Errorf("redis stream %s: %v", c.config.Stream, err)
+			}
+		}
+		select {
+		case <-c.ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (c *StreamConsumer) read() error {
+	streams, err := c.rdb.XReadGroup(c.ctx, &redis.XReadGroupArgs{
+		Group:    c.config.Group,
+		Consumer: c.config.Consumer,
+		Streams:  []string{c.config.Stream, ">"},
+		Count:    c.config.BatchSize,
+		Block:    time.Duration(c.config.BlockMs) * time.Millisecond,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			c.process(msg, 1)
+		}
+	}
+	return nil
+}
+
+// claim takes over the entries pending longer than claim_idle_ms, whether
+// their consumer died or their handler failed.
+func (c *StreamConsumer) claim() error {
+	start := "0-0"
+	for {
+		messages, next, err := c.rdb.XAutoClaim(c.ctx, &redis.XAutoClaimArgs{
+			Stream:   c.config.Stream,
+			Group:    c.config.Group,
+			Consumer: c.config.Consumer,
+			MinIdle:  time.Duration(c.config.ClaimIdleMs) * time.Millisecond,
+			Start:    start,
+			Count:    c.config.BatchSize,
+		}).Result()
+		if err != nil {
+			return err
+		}
+
+		if len(messages) > 0 {
+			deliveries, err := c.deliveries(messages)
+			if err != nil {
+				return err
+			}
+			for _, msg := range messages {
+				if c.ctx.Err() != nil {
+					return nil
+				}
+				c.process(msg, max(deliveries[msg.ID], 1))
+			}
+		}
+
+		if next == "0-0" || c.ctx.Err() != nil {
+			return nil
+		}
+		start = next
+	}
+}
+
+// deliveries looks up how often each claimed entry has been delivered.
+func (c *StreamConsumer) deliveries(messages []redis.XMessage) (map[string]int64, error) {
+	pending, err := c.rdb.XPendingExt(c.ctx, &redis.XPendingExtArgs{
+		Stream:   c.config.Stream,
+		Group:    c.config.Group,
+		Start:    messages[0].ID,
+		End:      messages[len(messages)-1].ID,
+		Count:    int64(len(messages)),
+		Consumer: c.config.Consumer,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make(map[string]int64, len(pending))
+	for _, p := range pending {
+		deliveries[p.ID] = p.RetryCount
+	}
+	return deliveries, nil
+}
+
+func (c *StreamConsumer) process(msg redis.XMessage, delivery int64) {
+	maxDeliveries := int64(c.config.RetryCount) + 1
+	body, _ := msg.Values[streamBodyField].(string)
+
+	// an entry that keeps killing its consumers never reaches the handler again
+	if delivery > maxDeliveries {
+		c.deadLetter(msg, body, delivery, errors.New("delivery limit exceeded"))
+		return
+	}
+
+	if err := c.handler([]byte(body)); err != nil {
+		hlog.Warnf("redis stream %s entry %s delivery %d failed: %v", c.config.Stream, msg.ID, delivery, err)
+		if delivery >= maxDeliveries {
+			c.deadLetter(msg, body, delivery, err)
+		}
+		return
+	}
+	if err := c.rdb.XAck(context.Background(), c.config.Stream, c.config.Group, msg.ID).Err(); err != nil {
+		hlog.Errorf("redis stream %s ack %s failed: %v", c.config.Stream, msg.ID, err)
+	}
+}
+
+// deadLetter copies the entry to the dead-letter stream before acking it, so
+// a failure in between at worst dead-letters it twice.
+func (c *StreamConsumer) deadLetter(msg redis.XMessage, body string, delivery int64, cause error) {
+	err := c.rdb.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: c.config.DeadLetterStream,
+		Values: []interface{}{
+			streamBodyField, body,
+			"id", msg.ID,
+			"stream", c.config.Stream,
+			"group", c.config.Group,
+			"deliveries", delivery,
+			"error", cause.Error(),
+		},
+	}).Err()
+	if err != nil {
+		hlog.Errorf("redis stream %s dead-letter %s failed: %v", c.config.Stream, msg.ID, err)
+		return
+	}
+	hlog.Warnf("redis stream %s entry %s moved to %s after %d deliveries: %v",
+		c.config.Stream, msg.ID, c.config.DeadLetterStream, delivery, cause)
+	if err := c.rdb.XAck(context.Background(), c.config.Stream, c.config.Group, msg.ID).Err(); err != nil {
+		hlog.Errorf("redis stream %s ack %s failed: %v", c.config.Stream, msg.ID, err)
+	}
+}
@@ -0,0 +1,128 @@
+package redis
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func testStreamConsumerConf(consumer string) *StreamConsumerConf {
+	return &StreamConsumerConf{
+		Stream:          "jobs",
+		Group:           "workers",
+		Consumer:        consumer,
+		BlockMs:         20,
+		RetryCount:      2,
+		ClaimIdleMs:     50,
+		ClaimIntervalMs: 10,
+	}
+}
+
+func TestStream_PublishConsume(t *testing.T) {
+	_, rdb := newTestClient(t)
+	consumer, err := NewStreamConsumer(rdb, testStreamConsumerConf("a"))
+	assert.NoError(t, err)
+	producer, err := NewStreamProducer(rdb, &StreamProducerConf{Stream: "jobs"})
+	assert.NoError(t, err)
+
+	received := make(chan string, 3)
+	assert.NoError(t, consumer.Start(func(body []byte) error {
+		received <- string(body)
+		return nil
+	}))
+	defer consumer.Stop()
+
+	for _, body := range []string{"1", "2", "3"} {
+		assert.NoError(t, producer.Publish([]byte(body)))
+	}
+	for _, want := range []string{"1", "2", "3"} {
+		select {
+		case got := <-received:
+			assert.Equal(t, want, got)
+		case <-time.After(2 * time.Second):
+			t.Fatal("message not consumed")
+		}
+	}
+
+	assert.Eventually(t, func() bool {
+		pending, err := rdb.XPending(context.Background(), "jobs", "workers").Result()
+		return err == nil && pending.Count == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestStream_RetryThenDeadLetter(t *testing.T) {
+	_, rdb := newTestClient(t)
+	consumer, err := NewStreamConsumer(rdb, testStreamConsumerConf("a"))
+	assert.NoError(t, err)
+	producer, _ := NewStreamProducer(rdb, &StreamProducerConf{Stream: "jobs"})
+
+	var calls atomic.Int32
+	assert.NoError(t, consumer.Start(func(body []byte) error {
+		calls.Add(1)
+		return assert.AnError
+	}))
+	defer consumer.Stop()
+	assert.NoError(t, producer.Publish([]byte("poison")))
+
+	ctx := context.Background()
+	assert.Eventually(t, func() bool {
+		n, _ := rdb.XLen(ctx, "jobs:dead").Result()
+		return n == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(3), calls.Load())
+
+	dead, err := rdb.XRange(ctx, "jobs:dead", "-", "+").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, "poison", dead[0].Values["body"])
+	assert.Equal(t, "3", dead[0].Values["deliveries"])
+	assert.Equal(t, assert.AnError.Error(), dead[0].Values["error"])
+
+	pending, err := rdb.XPending(ctx, "jobs", "workers").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), pending.Count)
+}
+
+func TestStream_ReclaimFromDeadConsumer(t *testing.T) {
+	_, rdb := newTestClient(t)
+	ctx := context.Background()
+	conf := testStreamConsumerConf("alive")
+	consumer, err := NewStreamConsumer(rdb, conf)
+	assert.NoError(t, err)
+	producer, _ := NewStreamProducer(rdb, &StreamProducerConf{Stream: "jobs"})
+	assert.NoError(t, producer.Publish([]byte("orphan")))
+
+	// another consumer reads the entry and dies before acking it
+	_, err = rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group: "workers", Consumer: "dead", Streams: []string{"jobs", ">"}, Count: 1,
+	}).Result()
+	assert.NoError(t, err)
+
+	received := make(chan string, 1)
+	assert.NoError(t, consumer.Start(func(body []byte) error {
+		received <- string(body)
+		return nil
+	}))
+	defer consumer.Stop()
+
+	select {
+	case got := <-received:
+		assert.Equal(t, "orphan", got)
+	case <-time.After(2 * time.Second):
+		t.Fatal("pending entry not reclaimed")
+	}
+}
+
+func TestStream_ExistingGroup(t *testing.T) {
+	_, rdb := newTestClient(t)
+	_, err := NewStreamConsumer(rdb, testStreamConsumerConf("a"))
+	assert.NoError(t, err)
+	_, err = NewStreamConsumer(rdb, testStreamConsumerConf("b"))
+	assert.NoError(t, err)
+
+	_, err = NewStreamConsumer(rdb, &StreamConsumerConf{Stream: "jobs"})
+	assert.ErrorIs(t, err, ErrInvalidStreamConf)
+}
@@ -0,0 +1,206 @@
+package verify_code
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/dgdts/ts-gobase/kafka"
+)
+
+const (
+	AuditActionStore    = "store"
+	AuditActionValidate = "validate"
+	AuditActionReset    = "reset"
+	AuditActionSend     = "send"
+
+	AuditOutcomeSuccess = "success"
+)
+
+// AuditEvent records one call, Outcome is AuditOutcomeSuccess or the error.
+type AuditEvent struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`
+	Key     string    `json:"key"`
+	Purpose Purpose   `json:"purpose,omitempty"`
+	IP      string    `json:"ip,omitempty"`
+	Device  string    `json:"device,omitempty"`
+	Outcome string    `json:"outcome"`
+}
+
+// AuditSink must not block for long, it runs on the request path.
+type AuditSink interface {
+	Emit(ctx context.Context, event AuditEvent)
+}
+
+func WithAuditSink(sink AuditSink) ServiceOption {
+	return func(o *serviceOptions) {
+		o.audit = sink
+	}
+}
+
+func withPurpose(purpose Purpose) ServiceOption {
+	return func(o *serviceOptions) {
+		o.purpose = purpose
+	}
+}
+
+type auditor struct {
+	sink    AuditSink
+	purpose Purpose
+	now     func() time.Time
+}
+
+func newAuditor(o serviceOptions) auditor {
+	return auditor{sink: o.audit, purpose: o.purpose, now: o.now}
+}
+
+func (a auditor) emit(ctx context.Context, action, key, ip, device string, err error) {
+	if a.sink == nil {
+		return
+	}
+	outcome := AuditOutcomeSuccess
+	if err != nil {
+		outcome = err.Error()
+	}
+	a.sink.Emit(ctx, AuditEvent{
+		Time:    a.now(),
+		Action:  action,
+		Key:     key,
+		Purpose: a.purpose,
+		IP:      ip,
+		Device:  device,
+		Outcome: outcome,
+	})
+}
+
+type logAuditSink struct{}
+
+func NewLogAuditSink() AuditSink {
+	return logAuditSink{}
+}
+
+func (logAuditSink) Emit(ctx context.Context, event AuditEvent) {
+	hlog.CtxInfof(ctx, "verify code audit action:%s key:%s purpose:%s ip:%s device:%s outcome:%s",
+		event.Action, event.Key, event.Purpose, event.IP, event.Device, event.Outcome)
+}
+
+const defaultKafkaAuditBuffer = 1024
+
+type publisher interface {
+	Publish(message []byte) error
+}
+
+// KafkaAuditSink publishes events as json from a background goroutine, so a
+// sync producer waiting for the broker does not hold up the request.
+type KafkaAuditSink struct {
+	producer  publisher
+	events    chan []byte
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewKafkaAuditSink queues up to size events, default 1024, events emitted
+// while the queue is full are dropped. Failures are only logged.
+func NewKafkaAuditSink(producer *kafka.Producer, size int) *KafkaAuditSink {
+	return newKafkaAuditSink(producer, size)
+}
+
+func newKafkaAuditSink(producer publisher, size int) *KafkaAuditSink {
+	if size <= 0 {
+		size = defaultKafkaAuditBuffer
+	}
+	s := &KafkaAuditSink{
+		producer: producer,
+		events:   make(chan []byte, size),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *KafkaAuditSink) Emit(ctx context.Context, event AuditEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		hlog.CtxErrorf(ctx, "marshal verify code audit event failed: %v", err)
+		return
+	}
+	select {
+	case <-s.stop:
+		hlog.CtxWarnf(ctx, "verify code audit sink is closed, event dropped")
+		return
+	default:
+	}
+	select {
+	case s.events <- data:
+	default:
+		hlog.CtxWarnf(ctx, "verify code audit queue is full, event dropped")
+	}
+}
+
+// Close publishes the queued events and stops the sink.
+func (s *KafkaAuditSink) Close() {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+}
+
+func (s *KafkaAuditSink) run() {
+	defer close(s.done)
+	for {
+		select {
+		case data := <-s.events:
+			s.publish(data)
+		case <-s.stop:
+			for {
+				select {
+				case data := <-s.events:
+					s.publish(data)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *KafkaAuditSink) publish(data []byte) {
+	if err := s.producer.Publish(data); err != nil {
+		hlog.Errorf("publish verify code audit event failed: %v", err)
+	}
+}
+
+// MemoryAuditSink keeps events for tests.
+type MemoryAuditSink struct {
+	events chan AuditEvent
+}
+
+func NewMemoryAuditSink(size int) *MemoryAuditSink {
+	return &MemoryAuditSink{events: make(chan AuditEvent, size)}
+}
+
+// Emit drops the event when the buffer is full.
+func (s *MemoryAuditSink) Emit(ctx context.Context, event AuditEvent) {
+	select {
+	case s.events <- event:
+	default:
+	}
+}
+
+// Events returns and removes the buffered events.
+func (s *MemoryAuditSink) Events() []AuditEvent {
+	var events []AuditEvent
+	for {
+		select {
+		case event := <-s.events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
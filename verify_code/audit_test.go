@@ -0,0 +1,129 @@
+package verify_code
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudit(t *testing.T) {
+	for name, factory := range map[string]serviceFactory{"redis": newRedisFactory, "memory": newMemoryFactory} {
+		t.Run(name, func(t *testing.T) {
+			sink := NewMemoryAuditSink(16)
+			sender := NewMemorySender()
+			vc, _ := factory(t, testOption, WithAuditSink(sink), WithSender(sender))
+			ctx := context.Background()
+
+			_, err := SendVerifyCode(ctx, vc, "k", "1.1.1.1", Recipient{To: "+10000000000"}, WithDevice("dev"))
+			assert.NoError(t, err)
+			_, err = vc.StoreVerifyCode(ctx, "k", "111111", "1.1.1.1")
+			assert.Error(t, err)
+			_, _ = vc.ValidateVerifyCode(ctx, "k", "000000", "2.2.2.2")
+			assert.NoError(t, vc.ResetVerifyCode(ctx, "k"))
+
+			events := sink.Events()
+			assert.Len(t, events, 5)
+			for _, event := range events {
+				assert.Equal(t, "k", event.Key)
+				assert.Equal(t, time.Unix(1700000000, 0), event.Time)
+			}
+			assert.Equal(t, AuditEvent{
+				Time: events[0].Time, Action: AuditActionStore, Key: "k", IP: "1.1.1.1", Device: "dev", Outcome: AuditOutcomeSuccess,
+			}, events[0])
+			assert.Equal(t, AuditActionSend, events[1].Action)
+			assert.Equal(t, AuditOutcomeSuccess, events[1].Outcome)
+			assert.Equal(t, RedisStoreVerifyCodeErrFast.Error(), events[2].Outcome)
+			assert.Equal(t, AuditActionValidate, events[3].Action)
+			assert.Equal(t, "2.2.2.2", events[3].IP)
+			assert.Equal(t, RedisValidateVerifyCodeErr.Error(), events[3].Outcome)
+			assert.Equal(t, AuditActionReset, events[4].Action)
+		})
+	}
+}
+
+func TestAudit_Purpose(t *testing.T) {
+	sink := NewMemoryAuditSink(16)
+	purposes := NewMemoryPurposeVerifyCode(testOption, WithAuditSink(sink))
+
+	_, err := purposes.For(PurposePayment).StoreVerifyCode(context.Background(), "k", "111111", "ip")
+	assert.NoError(t, err)
+	events := sink.Events()
+	assert.Len(t, events, 1)
+	assert.Equal(t, PurposePayment, events[0].Purpose)
+}
+
+type fakePublisher struct {
+	mutex    sync.Mutex
+	messages [][]byte
+	err      error
+	block    chan struct{}
+}
+
+func (p *fakePublisher) Publish(message []byte) error {
+	if p.block != nil {
+		<-p.block
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.messages = append(p.messages, message)
+	return p.err
+}
+
+func (p *fakePublisher) published() [][]byte {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.messages
+}
+
+func TestKafkaAuditSink(t *testing.T) {
+	producer := &fakePublisher{}
+	sink := newKafkaAuditSink(producer, 0)
+
+	event := AuditEvent{
+		Time:    time.Unix(1700000000, 0).UTC(),
+		Action:  AuditActionValidate,
+		Key:     "k",
+		Purpose: PurposeLogin,
+		IP:      "1.1.1.1",
+		Outcome: AuditOutcomeSuccess,
+	}
+	sink.Emit(context.Background(), event)
+	assert.Eventually(t, func() bool { return len(producer.published()) == 1 }, time.Second, 5*time.Millisecond)
+
+	var decoded AuditEvent
+	assert.NoError(t, json.Unmarshal(producer.published()[0], &decoded))
+	assert.Equal(t, event, decoded)
+
+	// a broken broker does not fail the request
+	producer.mutex.Lock()
+	producer.err = errors.New("broker down")
+	producer.mutex.Unlock()
+	sink.Emit(context.Background(), event)
+	sink.Close()
+	assert.Len(t, producer.published(), 2)
+}
+
+func TestKafkaAuditSink_SlowBroker(t *testing.T) {
+	producer := &fakePublisher{block: make(chan struct{})}
+	sink := newKafkaAuditSink(producer, 2)
+
+	// the first event is held by the publisher, two are queued, the rest dropped
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		sink.Emit(context.Background(), AuditEvent{Action: AuditActionSend, Outcome: AuditOutcomeSuccess})
+	}
+	assert.Less(t, time.Since(start), 100*time.Millisecond, "Emit should not wait for the broker")
+
+	close(producer.block)
+	sink.Close()
+	assert.LessOrEqual(t, len(producer.published()), 3)
+	assert.GreaterOrEqual(t, len(producer.published()), 2)
+
+	sink.Emit(context.Background(), AuditEvent{Action: AuditActionSend})
+	assert.LessOrEqual(t, len(producer.published()), 3, "Events after Close should be dropped")
+}
@@ -0,0 +1,76 @@
+package verify_code
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+const (
+	CodeTypeNumeric      = "numeric"
+	CodeTypeAlphanumeric = "alphanumeric"
+
+	defaultCodeLength = 6
+
+	numericAlphabet = "0123456789"
+	// no 0/O and 1/I/L, codes are typed by hand
+	alphanumericAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+)
+
+// GenerateCode returns a random code from crypto/rand.
+func GenerateCode(length int, codeType string) (string, error) {
+	if length <= 0 {
+		length = defaultCodeLength
+	}
+
+	var alphabet string
+	switch codeType {
+	case "", CodeTypeNumeric:
+		alphabet = numericAlphabet
+	case CodeTypeAlphanumeric:
+		alphabet = alphanumericAlphabet
+	default:
+		return "", fmt.Errorf("unknown verify code type: %s", codeType)
+	}
+
+	max := big.NewInt(int64(len(alphabet)))
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = alphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// hashCode is what gets stored instead of the code. The key is mixed in so
+// equal codes of different keys have different hashes.
+func hashCode(secret, key, code string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(key))
+	mac.Write([]byte{0})
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// warnEmptyHashKey is logged by the services created without a HashKey, the
+// hash of a short code under a known key is reversed offline at once.
+func warnEmptyHashKey(service string) {
+	hlog.Errorf("%s: hash_key is empty, stored verify codes can be brute forced offline, set hash_key in production", service)
+}
+
+// codeExpireAt is the expiry of a code stored at unix time storedAt.
+func codeExpireAt(storedAt int64, lifetime int) time.Time {
+	if storedAt <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(storedAt+int64(lifetime), 0)
+}
@@ -0,0 +1,31 @@
+package verify_code
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateCode(t *testing.T) {
+	code, err := GenerateCode(0, "")
+	assert.NoError(t, err)
+	assert.Len(t, code, defaultCodeLength)
+	assert.Empty(t, strings.Trim(code, numericAlphabet))
+
+	code, err = GenerateCode(8, CodeTypeAlphanumeric)
+	assert.NoError(t, err)
+	assert.Len(t, code, 8)
+	assert.Empty(t, strings.Trim(code, alphanumericAlphabet))
+
+	_, err = GenerateCode(6, "emoji")
+	assert.Error(t, err)
+}
+
+func TestHashCode(t *testing.T) {
+	hash := hashCode("secret", "user1", "123456")
+	assert.NotContains(t, hash, "123456")
+	assert.Equal(t, hash, hashCode("secret", "user1", "123456"))
+	assert.NotEqual(t, hash, hashCode("secret", "user2", "123456"))
+	assert.NotEqual(t, hash, hashCode("other", "user1", "123456"))
+}
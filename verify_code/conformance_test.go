@@ -0,0 +1,258 @@
+package verify_code
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// serviceFactory returns a service on a fake clock and a func moving that
+// clock, and the clock of the storage behind it, forward.
+type serviceFactory func(t *testing.T, opt VerifyCodeOption, opts ...ServiceOption) (VerifyCode, func(time.Duration))
+
+func newRedisFactory(t *testing.T, opt VerifyCodeOption, opts ...ServiceOption) (VerifyCode, func(time.Duration)) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	opts = append(opts, WithClock(clock.Now))
+	return NewRedisVerifyCodeService(rdb, opt, "code:%s", opts...), func(d time.Duration) {
+		clock.Advance(d)
+		mr.FastForward(d)
+	}
+}
+
+func newMemoryFactory(t *testing.T, opt VerifyCodeOption, opts ...ServiceOption) (VerifyCode, func(time.Duration)) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	opts = append(opts, WithClock(clock.Now))
+	return NewMemoryVerifyCodeService(opt, opts...), clock.Advance
+}
+
+func TestConformance_Redis(t *testing.T) {
+	runConformance(t, newRedisFactory)
+}
+
+func TestConformance_Memory(t *testing.T) {
+	runConformance(t, newMemoryFactory)
+}
+
+func validateErr(vc VerifyCode, key, code, ip string) error {
+	_, err := vc.ValidateVerifyCode(context.Background(), key, code, ip)
+	return err
+}
+
+func runConformance(t *testing.T, factory serviceFactory) {
+	ctx := context.Background()
+
+	t.Run("Interval", func(t *testing.T) {
+		vc, advance := factory(t, testOption)
+
+		result, err := vc.StoreVerifyCode(ctx, "k", "111111", "ip")
+		assert.NoError(t, err)
+		assert.Equal(t, 60, result.ResendAfter)
+
+		advance(20 * time.Second)
+		result, err = vc.StoreVerifyCode(ctx, "k", "222222", "ip")
+		assert.ErrorIs(t, err, RedisStoreVerifyCodeErrFast)
+		assert.Equal(t, 40, result.ResendAfter)
+		assert.NoError(t, validateErr(vc, "k", "111111", "ip"))
+
+		advance(40 * time.Second)
+		_, err = vc.StoreVerifyCode(ctx, "k", "222222", "ip")
+		assert.NoError(t, err)
+	})
+
+	t.Run("DailyLimit", func(t *testing.T) {
+		opt := testOption
+		opt.Limit = 2
+		vc, advance := factory(t, opt)
+
+		for i := 0; i < 2; i++ {
+			_, err := vc.StoreVerifyCode(ctx, "k", "111111", "ip")
+			assert.NoError(t, err)
+			advance(time.Minute)
+		}
+		_, err := vc.StoreVerifyCode(ctx, "k", "111111", "ip")
+		assert.ErrorIs(t, err, RedisStoreVerifyCodeErrLimit)
+
+		// the counter lives 24h after the last send
+		advance(24 * time.Hour)
+		_, err = vc.StoreVerifyCode(ctx, "k", "111111", "ip")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Lifetime", func(t *testing.T) {
+		vc, advance := factory(t, testOption)
+
+		_, err := vc.StoreVerifyCode(ctx, "k", "111111", "ip")
+		assert.NoError(t, err)
+		advance(301 * time.Second)
+		assert.ErrorIs(t, validateErr(vc, "k", "111111", "ip"), RedisValidateVerifyCodeExpired)
+	})
+
+	t.Run("ErrorTimes", func(t *testing.T) {
+		vc, _ := factory(t, testOption)
+
+		_, err := vc.StoreVerifyCode(ctx, "k", "111111", "ip")
+		assert.NoError(t, err)
+		for i := 0; i <= testOption.ErrorTimes; i++ {
+			assert.ErrorIs(t, validateErr(vc, "k", "000000", "ip"), RedisValidateVerifyCodeErr)
+		}
+		// too many errors burn the code
+		assert.ErrorIs(t, validateErr(vc, "k", "111111", "ip"), RedisNeedResetVerifyCode)
+	})
+
+	t.Run("SuccessTimes", func(t *testing.T) {
+		vc, _ := factory(t, testOption)
+
+		_, err := vc.StoreVerifyCode(ctx, "k", "111111", "ip")
+		assert.NoError(t, err)
+		for i := 0; i <= testOption.SuccessTimes; i++ {
+			assert.NoError(t, validateErr(vc, "k", "111111", "ip"))
+		}
+		assert.ErrorIs(t, validateErr(vc, "k", "111111", "ip"), RedisNeedResetVerifyCode)
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		vc, _ := factory(t, testOption)
+
+		assert.NoError(t, vc.ResetVerifyCode(ctx, "missing"))
+		assert.ErrorIs(t, validateErr(vc, "missing", "111111", "ip"), RedisValidateVerifyCodeErr)
+
+		_, err := vc.StoreVerifyCode(ctx, "k", "111111", "ip")
+		assert.NoError(t, err)
+		assert.NoError(t, vc.ResetVerifyCode(ctx, "k"))
+		assert.ErrorIs(t, validateErr(vc, "k", "111111", "ip"), RedisValidateVerifyCodeErr)
+
+		// the interval still applies after a reset
+		_, err = vc.StoreVerifyCode(ctx, "k", "111111", "ip")
+		assert.ErrorIs(t, err, RedisStoreVerifyCodeErrFast)
+	})
+
+	t.Run("AbuseLimits", func(t *testing.T) {
+		opt := testOption
+		opt.IPLimit = RateLimit{Limit: 2, Window: 3600}
+		opt.DeviceLimit = RateLimit{Limit: 3, Window: 3600}
+		opt.PrefixLimit = RateLimit{Limit: 4, Window: 600}
+		opt.PrefixLength = 3
+		vc, advance := factory(t, opt)
+
+		_, err := vc.StoreVerifyCode(ctx, "a", "1", "1.1.1.1")
+		assert.NoError(t, err)
+		_, err = vc.StoreVerifyCode(ctx, "b", "1", "1.1.1.1")
+		assert.NoError(t, err)
+		result, err := vc.StoreVerifyCode(ctx, "c", "1", "1.1.1.1")
+		assert.ErrorIs(t, err, RedisStoreVerifyCodeErrIPLimit)
+		assert.Equal(t, 3600, result.ResendAfter)
+		// a rejected request stores nothing
+		assert.ErrorIs(t, validateErr(vc, "c", "1", "1.1.1.1"), RedisValidateVerifyCodeErr)
+
+		for i, ip := range []string{"2.2.2.2", "3.3.3.3", "4.4.4.4"} {
+			_, err = vc.StoreVerifyCode(ctx, ip, "1", ip, WithDevice("dev"))
+			assert.NoError(t, err, i)
+		}
+		_, err = vc.StoreVerifyCode(ctx, "g", "1", "5.5.5.5", WithDevice("dev"))
+		assert.ErrorIs(t, err, RedisStoreVerifyCodeErrDevice)
+
+		for _, ip := range []string{"6.6.6.6", "7.7.7.7", "8.8.8.8", "9.9.9.9"} {
+			_, err = vc.StoreVerifyCode(ctx, ip, "1", ip, WithDestination("+86138"+ip))
+			assert.NoError(t, err)
+		}
+		_, err = vc.StoreVerifyCode(ctx, "h", "1", "10.0.0.1", WithDestination("+8613900000000"))
+		assert.ErrorIs(t, err, RedisStoreVerifyCodeErrPrefix)
+		_, err = vc.StoreVerifyCode(ctx, "h", "1", "10.0.0.1", WithDestination("+4415500000000"))
+		assert.NoError(t, err)
+
+		advance(3601 * time.Second)
+		_, err = vc.StoreVerifyCode(ctx, "c", "1", "1.1.1.1")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Results", func(t *testing.T) {
+		opt := testOption
+		opt.Limit = 3
+		vc, advance := factory(t, opt)
+		storedAt := time.Unix(1700000000, 0)
+
+		result, err := vc.StoreVerifyCode(ctx, "k", "111111", "ip")
+		assert.NoError(t, err)
+		assert.Equal(t, StoreResult{
+			ResendAfter:    60,
+			RemainingSends: 2,
+			ExpireAt:       storedAt.Add(300 * time.Second),
+		}, result)
+
+		advance(10 * time.Second)
+		result, err = vc.StoreVerifyCode(ctx, "k", "222222", "ip")
+		assert.ErrorIs(t, err, RedisStoreVerifyCodeErrFast)
+		assert.Equal(t, StoreResult{
+			ResendAfter:    50,
+			RemainingSends: 2,
+			ExpireAt:       storedAt.Add(300 * time.Second),
+		}, result)
+
+		validation, err := vc.ValidateVerifyCode(ctx, "k", "000000", "ip")
+		assert.ErrorIs(t, err, RedisValidateVerifyCodeErr)
+		assert.Equal(t, ValidateResult{
+			RemainingAttempts: testOption.ErrorTimes,
+			ExpireAt:          storedAt.Add(300 * time.Second),
+		}, validation)
+
+		validation, err = vc.ValidateVerifyCode(ctx, "k", "111111", "ip")
+		assert.NoError(t, err)
+		assert.Equal(t, testOption.ErrorTimes, validation.RemainingAttempts)
+
+		for i := 0; i < 2; i++ {
+			advance(time.Minute)
+			_, err = vc.StoreVerifyCode(ctx, "k", "111111", "ip")
+			assert.NoError(t, err)
+		}
+		result, err = vc.StoreVerifyCode(ctx, "k", "111111", "ip")
+		assert.ErrorIs(t, err, RedisStoreVerifyCodeErrFast)
+		assert.Equal(t, 0, result.RemainingSends)
+
+		advance(time.Minute)
+		result, err = vc.StoreVerifyCode(ctx, "k", "111111", "ip")
+		assert.ErrorIs(t, err, RedisStoreVerifyCodeErrLimit)
+		// the daily counter expires 24h after the last send
+		assert.Equal(t, 24*3600-60, result.ResendAfter)
+
+		validation, err = vc.ValidateVerifyCode(ctx, "missing", "111111", "ip")
+		assert.ErrorIs(t, err, RedisValidateVerifyCodeErr)
+		assert.Equal(t, ValidateResult{}, validation)
+	})
+
+	t.Run("Send", func(t *testing.T) {
+		sender := NewMemorySender()
+		vc, _ := factory(t, testOption, WithSender(sender))
+
+		_, err := SendVerifyCode(ctx, vc, "k", "ip", Recipient{To: "+10000000000"})
+		assert.NoError(t, err)
+		code, ok := sender.LastCode("+10000000000")
+		assert.True(t, ok)
+		assert.NoError(t, validateErr(vc, "k", code, "ip"))
+	})
+}
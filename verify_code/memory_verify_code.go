@@ -0,0 +1,254 @@
+package verify_code
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	memoryCodeKeepSeconds = 3600 * 24 // same as the EXPIRE of the redis hash
+	memorySweepInterval   = time.Minute
+)
+
+type memoryCodeEntry struct {
+	code     string // hash, empty once reset
+	time     int64
+	ip       string
+	success  int
+	error    int
+	total    int
+	expireAt int64
+}
+
+type memoryLimitCounter struct {
+	count    int
+	expireAt int64
+}
+
+type memoryVerifyCodeService struct {
+	option  VerifyCodeOption
+	sender  Sender
+	auditor auditor
+	now     func() time.Time
+
+	mutex     sync.Mutex
+	codes     map[string]*memoryCodeEntry
+	limits    map[string]*memoryLimitCounter
+	lastSweep int64
+}
+
+// NewMemoryVerifyCodeService keeps codes in process with the same rules as
+// the redis scripts, for tests and single node deployments.
+func NewMemoryVerifyCodeService(opt VerifyCodeOption, opts ...ServiceOption) VerifyCode {
+	if opt.HashKey == "" {
+		warnEmptyHashKey("NewMemoryVerifyCodeService")
+	}
+	o := newServiceOptions(opts)
+	return &memoryVerifyCodeService{
+		option:  opt,
+		sender:  o.sender,
+		auditor: newAuditor(o),
+		now:     o.now,
+		codes:   make(map[string]*memoryCodeEntry),
+		limits:  make(map[string]*memoryLimitCounter),
+	}
+}
+
+func (s *memoryVerifyCodeService) StoreVerifyCode(ctx context.Context, key, code, ip string, opts ...RequestOption) (StoreResult, error) {
+	o := newRequestOptions(opts)
+	result, err := s.storeVerifyCode(ctx, key, code, ip, o)
+	s.auditor.emit(ctx, AuditActionStore, key, ip, o.device, err)
+	return result, err
+}
+
+func (s *memoryVerifyCodeService) storeVerifyCode(ctx context.Context, key, code, ip string, o requestOptions) (StoreResult, error) {
+	now := s.now().Unix()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sweepLocked(now)
+
+	entry := s.getLocked(key, now)
+	var storedAt int64
+	total := 0
+	if entry != nil {
+		storedAt, total = entry.time, entry.total
+	}
+	if storedAt > 0 && now-storedAt < int64(s.option.Interval) {
+		return StoreResult{
+			ResendAfter:    int(int64(s.option.Interval) + storedAt - now),
+			RemainingSends: max(s.option.Limit-total, 0),
+			ExpireAt:       codeExpireAt(storedAt, s.option.Lifetime),
+		}, RedisStoreVerifyCodeErrFast
+	}
+	if total >= s.option.Limit {
+		result := StoreResult{ExpireAt: codeExpireAt(storedAt, s.option.Lifetime)}
+		if entry != nil {
+			result.ResendAfter = int(entry.expireAt - now)
+		}
+		return result, RedisStoreVerifyCodeErrLimit
+	}
+
+	type limitKey struct {
+		key   string
+		limit RateLimit
+		err   error
+	}
+	var limitKeys []limitKey
+	addLimit := func(limit RateLimit, name, value string, err error) {
+		if limit.enabled() && value != "" {
+			limitKeys = append(limitKeys, limitKey{key: name + ":" + value, limit: limit, err: err})
+		}
+	}
+	addLimit(s.option.IPLimit, "ip", ip, RedisStoreVerifyCodeErrIPLimit)
+	addLimit(s.option.DeviceLimit, "device", o.device, RedisStoreVerifyCodeErrDevice)
+	if o.destination != "" {
+		addLimit(s.option.PrefixLimit, "prefix", destinationPrefix(o.destination, s.option.PrefixLength), RedisStoreVerifyCodeErrPrefix)
+	}
+
+	for _, lk := range limitKeys {
+		counter := s.limits[lk.key]
+		if counter != nil && counter.expireAt > now && counter.count >= lk.limit.Limit {
+			return StoreResult{
+				ResendAfter:    int(counter.expireAt - now),
+				RemainingSends: s.option.Limit - total,
+				ExpireAt:       codeExpireAt(storedAt, s.option.Lifetime),
+			}, lk.err
+		}
+	}
+	for _, lk := range limitKeys {
+		counter := s.limits[lk.key]
+		if counter == nil || counter.expireAt <= now {
+			counter = &memoryLimitCounter{expireAt: now + int64(lk.limit.Window)}
+			s.limits[lk.key] = counter
+		}
+		counter.count++
+	}
+
+	if entry == nil {
+		entry = &memoryCodeEntry{}
+		s.codes[key] = entry
+	}
+	entry.code = hashCode(s.option.HashKey, key, code)
+	entry.time = now
+	entry.ip = ip
+	entry.success = 0
+	entry.error = 0
+	entry.total++
+	entry.expireAt = now + memoryCodeKeepSeconds
+	return StoreResult{
+		ResendAfter:    s.option.Interval,
+		RemainingSends: s.option.Limit - entry.total,
+		ExpireAt:       codeExpireAt(now, s.option.Lifetime),
+	}, nil
+}
+
+func (s *memoryVerifyCodeService) ValidateVerifyCode(ctx context.Context, key, code, ip string) (ValidateResult, error) {
+	result, err := s.validateVerifyCode(ctx, key, code, ip, s.option.SuccessTimes)
+	s.auditor.emit(ctx, AuditActionValidate, key, ip, "", err)
+	return result, err
+}
+
+func (s *memoryVerifyCodeService) redeemVerifyCode(ctx context.Context, key, code, ip string) (ValidateResult, error) {
+	result, err := s.validateVerifyCode(ctx, key, code, ip, 0)
+	s.auditor.emit(ctx, AuditActionValidate, key, ip, "", err)
+	return result, err
+}
+
+// validateVerifyCode clears the code once it succeeded more than
+// successTimes times.
+func (s *memoryVerifyCodeService) validateVerifyCode(ctx context.Context, key, code, ip string, successTimes int) (ValidateResult, error) {
+	now := s.now().Unix()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry := s.getLocked(key, now)
+	if entry == nil {
+		return ValidateResult{}, RedisValidateVerifyCodeErr
+	}
+
+	if entry.code != "" {
+		expireAt := codeExpireAt(entry.time, s.option.Lifetime)
+		if entry.code != hashCode(s.option.HashKey, key, code) {
+			entry.error++
+			if entry.error > s.option.ErrorTimes {
+				entry.code = ""
+			}
+			return ValidateResult{
+				RemainingAttempts: max(s.option.ErrorTimes+1-entry.error, 0),
+				ExpireAt:          expireAt,
+			}, RedisValidateVerifyCodeErr
+		}
+		result := ValidateResult{
+			RemainingAttempts: s.option.ErrorTimes + 1 - entry.error,
+			ExpireAt:          expireAt,
+		}
+		if now-entry.time > int64(s.option.Lifetime) {
+			return result, RedisValidateVerifyCodeExpired
+		}
+		entry.success++
+		if entry.success > successTimes {
+			entry.code = ""
+		}
+		return result, nil
+	}
+
+	if entry.error > 0 || entry.success > 0 {
+		return ValidateResult{}, RedisNeedResetVerifyCode
+	}
+	return ValidateResult{}, RedisValidateVerifyCodeErr
+}
+
+func (s *memoryVerifyCodeService) ResetVerifyCode(ctx context.Context, key string) error {
+	err := s.resetVerifyCode(ctx, key)
+	s.auditor.emit(ctx, AuditActionReset, key, "", "", err)
+	return err
+}
+
+func (s *memoryVerifyCodeService) resetVerifyCode(ctx context.Context, key string) error {
+	now := s.now().Unix()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if entry := s.getLocked(key, now); entry != nil {
+		entry.code = ""
+	}
+	return nil
+}
+
+func (s *memoryVerifyCodeService) sendVerifyCode(ctx context.Context, key, ip string, recipient Recipient, opts []RequestOption) (StoreResult, error) {
+	return deliverVerifyCode(ctx, s, s.sender, s.auditor, s.option, key, ip, recipient, opts)
+}
+
+func (s *memoryVerifyCodeService) getLocked(key string, now int64) *memoryCodeEntry {
+	entry, ok := s.codes[key]
+	if !ok {
+		return nil
+	}
+	if entry.expireAt <= now {
+		delete(s.codes, key)
+		return nil
+	}
+	return entry
+}
+
+// sweepLocked drops expired entries at most once per memorySweepInterval.
+func (s *memoryVerifyCodeService) sweepLocked(now int64) {
+	if now-s.lastSweep < int64(memorySweepInterval/time.Second) {
+		return
+	}
+	s.lastSweep = now
+	for key, entry := range s.codes {
+		if entry.expireAt <= now {
+			delete(s.codes, key)
+		}
+	}
+	for key, counter := range s.limits {
+		if counter.expireAt <= now {
+			delete(s.limits, key)
+		}
+	}
+}
@@ -0,0 +1,415 @@
+package verify_code
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	OTPAlgorithmSHA1   = "SHA1"
+	OTPAlgorithmSHA256 = "SHA256"
+	OTPAlgorithmSHA512 = "SHA512"
+
+	defaultOTPDigits      = 6
+	minOTPDigits          = 6
+	maxOTPDigits          = 8
+	defaultOTPPeriod      = 30
+	defaultOTPErrorTimes  = 5
+	defaultOTPLockSeconds = 900
+	defaultSecretSize     = 20
+	recoveryCodeHalfSize  = 5
+	defaultRecoveryCodes  = 10
+	recoveryCodeSeparator = "-"
+)
+
+var (
+	ErrOTPInvalid          = errors.New("otp code is invalid")
+	ErrOTPReplayed         = errors.New("otp code is already used")
+	ErrOTPLocked           = errors.New("otp is locked after too many attempts")
+	ErrOTPSecret           = errors.New("otp secret is not valid base32")
+	ErrOTPDigits           = errors.New("otp digits must be between 6 and 8")
+	ErrOTPHashKey          = errors.New("otp hash_key must be set")
+	ErrRecoveryCodeInvalid = errors.New("recovery code is invalid")
+)
+
+var otpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type OTPConfig struct {
+	Issuer    string `yaml:"issuer"`
+	Digits    int    `yaml:"digits"`    // 6 (default) to 8
+	Period    int    `yaml:"period"`    // totp step in seconds, default 30
+	Skew      int    `yaml:"skew"`      // totp steps accepted on each side of now
+	Algorithm string `yaml:"algorithm"` // SHA1 (default), SHA256 or SHA512
+	HashKey   string `yaml:"hash_key"`  // secret for stored recovery code hashes, required
+
+	// ValidateTOTP and ValidateHOTP fail with ErrOTPLocked after ErrorTimes
+	// attempts without a success, until LockSeconds passed since the last one
+	ErrorTimes  int `yaml:"error_times"`  // default 5
+	LockSeconds int `yaml:"lock_seconds"` // default 900
+}
+
+func (c OTPConfig) digits() int {
+	if c.Digits <= 0 {
+		return defaultOTPDigits
+	}
+	return c.Digits
+}
+
+func (c OTPConfig) period() int {
+	if c.Period <= 0 {
+		return defaultOTPPeriod
+	}
+	return c.Period
+}
+
+func (c OTPConfig) errorTimes() int {
+	if c.ErrorTimes <= 0 {
+		return defaultOTPErrorTimes
+	}
+	return c.ErrorTimes
+}
+
+func (c OTPConfig) lockSeconds() int {
+	if c.LockSeconds <= 0 {
+		return defaultOTPLockSeconds
+	}
+	return c.LockSeconds
+}
+
+func (c OTPConfig) algorithm() string {
+	if c.Algorithm == "" {
+		return OTPAlgorithmSHA1
+	}
+	return strings.ToUpper(c.Algorithm)
+}
+
+func otpHash(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToUpper(algorithm) {
+	case "", OTPAlgorithmSHA1:
+		return sha1.New, nil
+	case OTPAlgorithmSHA256:
+		return sha256.New, nil
+	case OTPAlgorithmSHA512:
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unknown otp algorithm: %s", algorithm)
+}
+
+// GenerateSecret returns a random base32 secret for an authenticator app.
+func GenerateSecret() (string, error) {
+	secret := make([]byte, defaultSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return otpEncoding.EncodeToString(secret), nil
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	key, err := otpEncoding.DecodeString(strings.TrimRight(secret, "="))
+	if err != nil || len(key) == 0 {
+		return nil, ErrOTPSecret
+	}
+	return key, nil
+}
+
+// HOTP is the RFC 4226 code of counter.
+func HOTP(secret string, counter uint64, digits int, algorithm string) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	newHash, err := otpHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	if digits <= 0 {
+		digits = defaultOTPDigits
+	}
+	if digits < minOTPDigits || digits > maxOTPDigits {
+		return "", ErrOTPDigits
+	}
+	return hotp(key, counter, digits, newHash), nil
+}
+
+func hotp(key []byte, counter uint64, digits int, newHash func() hash.Hash) string {
+	mac := hmac.New(newHash, key)
+	_ = binary.Write(mac, binary.BigEndian, counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+var (
+	useTOTPStepScript    = redis.NewScript(redisUseTOTPStepScript)
+	useHOTPCounterScript = redis.NewScript(redisUseHOTPCounterScript)
+)
+
+// Authenticator implements RFC 6238 TOTP and RFC 4226 HOTP for authenticator
+// apps, it keeps the last used totp step, the hotp counter and recovery codes
+// in redis.
+type Authenticator struct {
+	config      OTPConfig
+	rdb         redis.UniversalClient
+	keyTemplate string
+	newHash     func() hash.Hash
+	now         func() time.Time
+}
+
+// NewAuthenticator formats template with "totp:<key>", "hotp:<key>",
+// "attempts:<key>" and "recovery:<key>" for its redis keys. Only WithClock of the service options
+// applies.
+func NewAuthenticator(rdb redis.UniversalClient, config OTPConfig, template string, opts ...ServiceOption) (*Authenticator, error) {
+	newHash, err := otpHash(config.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if digits := config.digits(); digits < minOTPDigits || digits > maxOTPDigits {
+		return nil, ErrOTPDigits
+	}
+	// without a secret the stored recovery code hashes can be reversed offline
+	if config.HashKey == "" {
+		return nil, ErrOTPHashKey
+	}
+	o := newServiceOptions(opts)
+	return &Authenticator{
+		config:      config,
+		rdb:         rdb,
+		keyTemplate: template,
+		newHash:     newHash,
+		now:         o.now,
+	}, nil
+}
+
+func MustNewAuthenticator(rdb redis.UniversalClient, config OTPConfig, template string, opts ...ServiceOption) *Authenticator {
+	a, err := NewAuthenticator(rdb, config, template, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// URI is the otpauth:// uri of a totp secret, shown as a QR code on enrollment.
+func (a *Authenticator) URI(account, secret string) string {
+	return a.uri("totp", account, secret, url.Values{"period": {strconv.Itoa(a.config.period())}})
+}
+
+// HOTPURI is the otpauth:// uri of a hotp secret starting at counter.
+func (a *Authenticator) HOTPURI(account, secret string, counter uint64) string {
+	return a.uri("hotp", account, secret, url.Values{"counter": {strconv.FormatUint(counter, 10)}})
+}
+
+func (a *Authenticator) uri(otpType, account, secret string, query url.Values) string {
+	label := account
+	if a.config.Issuer != "" {
+		label = a.config.Issuer + ":" + account
+		query.Set("issuer", a.config.Issuer)
+	}
+	query.Set("secret", secret)
+	query.Set("algorithm", a.config.algorithm())
+	query.Set("digits", strconv.Itoa(a.config.digits()))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     otpType,
+		Path:     "/" + label,
+		RawQuery: strings.ReplaceAll(query.Encode(), "+", "%20"),
+	}
+	return u.String()
+}
+
+// TOTP returns the current code of secret.
+func (a *Authenticator) TOTP(secret string) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, a.step(a.now()), a.config.digits(), a.newHash), nil
+}
+
+func (a *Authenticator) step(t time.Time) uint64 {
+	return uint64(t.Unix()) / uint64(a.config.period())
+}
+
+// ValidateTOTP accepts a code of the current step or Skew steps around it.
+// A step that was accepted once for key, or any step before it, returns
+// ErrOTPReplayed.
+func (a *Authenticator) ValidateTOTP(ctx context.Context, key, secret, code string) error {
+	secretKey, err := decodeSecret(secret)
+	if err != nil {
+		return err
+	}
+	if err := a.takeAttempt(ctx, key); err != nil {
+		return err
+	}
+
+	current := a.step(a.now())
+	matched, ok := uint64(0), false
+	for i := -a.config.Skew; i <= a.config.Skew; i++ {
+		if i < 0 && current < uint64(-i) {
+			continue
+		}
+		step := current + uint64(i)
+		if subtle.ConstantTimeCompare([]byte(hotp(secretKey, step, a.config.digits(), a.newHash)), []byte(code)) == 1 {
+			matched, ok = step, true
+			break
+		}
+	}
+	if !ok {
+		return ErrOTPInvalid
+	}
+
+	// the last step only matters while codes around it are still accepted
+	ttl := a.config.period() * (2*a.config.Skew + 2)
+	used, err := useTOTPStepScript.Run(ctx, a.rdb, []string{fmt.Sprintf(a.keyTemplate, "totp:"+key)}, matched, ttl).Int()
+	if err != nil {
+		return err
+	}
+	if used == 0 {
+		return ErrOTPReplayed
+	}
+	a.resetAttempts(ctx, key)
+	return nil
+}
+
+// SetHOTPCounter stores the counter of key on enrollment, a key without one
+// starts at 0.
+func (a *Authenticator) SetHOTPCounter(ctx context.Context, key string, counter uint64) error {
+	return a.rdb.Set(ctx, fmt.Sprintf(a.keyTemplate, "hotp:"+key), strconv.FormatUint(counter, 10), 0).Err()
+}
+
+// ValidateHOTP looks for code at the stored counter of key and up to
+// lookAhead counters after it, and moves the counter one past the match. A
+// match the counter already passed, e.g. by a concurrent validation,
+// returns ErrOTPReplayed. It returns the counter after the call, 0 with
+// ErrOTPLocked.
+func (a *Authenticator) ValidateHOTP(ctx context.Context, key, secret, code string, lookAhead int) (uint64, error) {
+	secretKey, err := decodeSecret(secret)
+	if err != nil {
+		return 0, err
+	}
+	if err := a.takeAttempt(ctx, key); err != nil {
+		return 0, err
+	}
+	counterKey := fmt.Sprintf(a.keyTemplate, "hotp:"+key)
+	counter, err := a.rdb.Get(ctx, counterKey).Uint64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+
+	for i := 0; i <= lookAhead; i++ {
+		c := counter + uint64(i)
+		if subtle.ConstantTimeCompare([]byte(hotp(secretKey, c, a.config.digits(), a.newHash)), []byte(code)) != 1 {
+			continue
+		}
+		next, err := useHOTPCounterScript.Run(ctx, a.rdb, []string{counterKey}, strconv.FormatUint(c, 10)).Int64()
+		if err != nil {
+			return counter, err
+		}
+		if next < 0 {
+			return uint64(-next), ErrOTPReplayed
+		}
+		a.resetAttempts(ctx, key)
+		return uint64(next), nil
+	}
+	return counter, ErrOTPInvalid
+}
+
+// takeAttempt counts every attempt before the code is checked, so concurrent
+// guesses cannot get past ErrorTimes, a success resets the count.
+func (a *Authenticator) takeAttempt(ctx context.Context, key string) error {
+	attemptsKey := fmt.Sprintf(a.keyTemplate, "attempts:"+key)
+	var attempts *redis.IntCmd
+	_, err := a.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		attempts = pipe.Incr(ctx, attemptsKey)
+		pipe.Expire(ctx, attemptsKey, time.Duration(a.config.lockSeconds())*time.Second)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if attempts.Val() > int64(a.config.errorTimes()) {
+		return ErrOTPLocked
+	}
+	return nil
+}
+
+// resetAttempts only logs failures, the code was valid.
+func (a *Authenticator) resetAttempts(ctx context.Context, key string) {
+	if err := a.rdb.Del(ctx, fmt.Sprintf(a.keyTemplate, "attempts:"+key)).Err(); err != nil {
+		hlog.CtxWarnf(ctx, "reset otp attempts of %s failed: %v", key, err)
+	}
+}
+
+// GenerateRecoveryCodes replaces the recovery codes of key with count new
+// ones, default 10. Only their hashes are stored, the codes are shown once.
+func (a *Authenticator) GenerateRecoveryCodes(ctx context.Context, key string, count int) ([]string, error) {
+	if count <= 0 {
+		count = defaultRecoveryCodes
+	}
+
+	codes := make([]string, count)
+	hashes := make([]any, count)
+	for i := range codes {
+		raw, err := GenerateCode(recoveryCodeHalfSize*2, CodeTypeAlphanumeric)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = raw[:recoveryCodeHalfSize] + recoveryCodeSeparator + raw[recoveryCodeHalfSize:]
+		hashes[i] = hashCode(a.config.HashKey, key, raw)
+	}
+
+	recoveryKey := fmt.Sprintf(a.keyTemplate, "recovery:"+key)
+	_, err := a.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, recoveryKey)
+		pipe.SAdd(ctx, recoveryKey, hashes...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode consumes a recovery code, each one works once.
+func (a *Authenticator) UseRecoveryCode(ctx context.Context, key, code string) error {
+	normalized := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), recoveryCodeSeparator, ""))
+	recoveryKey := fmt.Sprintf(a.keyTemplate, "recovery:"+key)
+	removed, err := a.rdb.SRem(ctx, recoveryKey, hashCode(a.config.HashKey, key, normalized)).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrRecoveryCodeInvalid
+	}
+	return nil
+}
+
+func (a *Authenticator) RemainingRecoveryCodes(ctx context.Context, key string) (int, error) {
+	n, err := a.rdb.SCard(ctx, fmt.Sprintf(a.keyTemplate, "recovery:"+key)).Result()
+	return int(n), err
+}
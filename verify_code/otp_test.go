@@ -0,0 +1,227 @@
+package verify_code
+
+import (
+	"context"
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rfcSecret(raw string) string {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte(raw))
+}
+
+func TestHOTP_RFC4226(t *testing.T) {
+	secret := rfcSecret("12345678901234567890")
+	expected := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, want := range expected {
+		code, err := HOTP(secret, uint64(counter), 6, OTPAlgorithmSHA1)
+		assert.NoError(t, err)
+		assert.Equal(t, want, code)
+	}
+
+	_, err := HOTP("not base32!", 0, 6, "")
+	assert.ErrorIs(t, err, ErrOTPSecret)
+}
+
+func TestTOTP_RFC6238(t *testing.T) {
+	cases := []struct {
+		algorithm string
+		secret    string
+		unix      int64
+		want      string
+	}{
+		{OTPAlgorithmSHA1, "12345678901234567890", 59, "94287082"},
+		{OTPAlgorithmSHA256, "12345678901234567890123456789012", 59, "46119246"},
+		{OTPAlgorithmSHA512, "1234567890123456789012345678901234567890123456789012345678901234", 59, "90693936"},
+		{OTPAlgorithmSHA1, "12345678901234567890", 1111111109, "07081804"},
+		{OTPAlgorithmSHA1, "12345678901234567890", 20000000000, "65353130"},
+	}
+	for _, c := range cases {
+		clock := &fakeClock{now: time.Unix(c.unix, 0)}
+		a := MustNewAuthenticator(nil, OTPConfig{HashKey: testOption.HashKey, Digits: 8, Algorithm: c.algorithm}, "otp:%s", WithClock(clock.Now))
+		code, err := a.TOTP(rfcSecret(c.secret))
+		assert.NoError(t, err)
+		assert.Equal(t, c.want, code, c.algorithm)
+	}
+
+	_, err := NewAuthenticator(nil, OTPConfig{HashKey: testOption.HashKey, Algorithm: "MD5"}, "otp:%s")
+	assert.Error(t, err)
+
+	_, err = NewAuthenticator(nil, OTPConfig{}, "otp:%s")
+	assert.ErrorIs(t, err, ErrOTPHashKey)
+	assert.Error(t, err)
+}
+
+func TestAuthenticator_ValidateTOTP(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	a := MustNewAuthenticator(rdb, OTPConfig{HashKey: testOption.HashKey, Skew: 1}, "otp:%s", WithClock(clock.Now))
+	ctx := context.Background()
+
+	secret, err := GenerateSecret()
+	assert.NoError(t, err)
+
+	code, err := a.TOTP(secret)
+	assert.NoError(t, err)
+
+	// a code of the previous step is still accepted
+	clock.Advance(30 * time.Second)
+	assert.NoError(t, a.ValidateTOTP(ctx, "admin", secret, code))
+	assert.ErrorIs(t, a.ValidateTOTP(ctx, "admin", secret, code), ErrOTPReplayed)
+
+	// two steps later it is not
+	clock.Advance(60 * time.Second)
+	assert.ErrorIs(t, a.ValidateTOTP(ctx, "other", secret, code), ErrOTPInvalid)
+
+	code, err = a.TOTP(secret)
+	assert.NoError(t, err)
+	assert.NoError(t, a.ValidateTOTP(ctx, "admin", secret, code))
+	assert.ErrorIs(t, a.ValidateTOTP(ctx, "admin", secret, "000000x"), ErrOTPInvalid)
+}
+
+func TestAuthenticator_ValidateHOTP(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	a := MustNewAuthenticator(rdb, OTPConfig{HashKey: testOption.HashKey}, "otp:%s")
+	secret := rfcSecret("12345678901234567890")
+	ctx := context.Background()
+
+	assert.NoError(t, a.SetHOTPCounter(ctx, "token", 1))
+	next, err := a.ValidateHOTP(ctx, "token", secret, "969429", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), next)
+
+	next, err = a.ValidateHOTP(ctx, "token", secret, "969429", 3)
+	assert.ErrorIs(t, err, ErrOTPInvalid)
+	assert.Equal(t, uint64(4), next)
+
+	next, err = a.ValidateHOTP(ctx, "token", secret, "338314", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), next)
+}
+
+func TestAuthenticator_ValidateHOTPConcurrent(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	a := MustNewAuthenticator(rdb, OTPConfig{HashKey: testOption.HashKey}, "otp:%s")
+	secret := rfcSecret("12345678901234567890")
+	ctx := context.Background()
+
+	var accepted atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := a.ValidateHOTP(ctx, "token", secret, "755224", 3); err == nil {
+				accepted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), accepted.Load())
+}
+
+func TestAuthenticator_Lockout(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	a := MustNewAuthenticator(rdb, OTPConfig{HashKey: testOption.HashKey, ErrorTimes: 3, LockSeconds: 60}, "otp:%s", WithClock(clock.Now))
+	secret := rfcSecret("12345678901234567890")
+	ctx := context.Background()
+
+	code, err := a.TOTP(secret)
+	assert.NoError(t, err)
+
+	// a success resets the count
+	for i := 0; i < 2; i++ {
+		assert.ErrorIs(t, a.ValidateTOTP(ctx, "admin", secret, "000000"), ErrOTPInvalid)
+	}
+	assert.NoError(t, a.ValidateTOTP(ctx, "admin", secret, code))
+	assert.False(t, mr.Exists("otp:attempts:admin"))
+
+	for i := 0; i < 3; i++ {
+		_, err := a.ValidateHOTP(ctx, "admin", secret, "000000", 0)
+		assert.ErrorIs(t, err, ErrOTPInvalid)
+	}
+	// the right code does not help once locked
+	_, err = a.ValidateHOTP(ctx, "admin", secret, "755224", 0)
+	assert.ErrorIs(t, err, ErrOTPLocked)
+	clock.Advance(30 * time.Second)
+	code, err = a.TOTP(secret)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, a.ValidateTOTP(ctx, "admin", secret, code), ErrOTPLocked)
+	assert.NoError(t, a.ValidateTOTP(ctx, "other", secret, code))
+
+	mr.FastForward(60 * time.Second)
+	next, err := a.ValidateHOTP(ctx, "admin", secret, "755224", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), next)
+}
+
+func TestAuthenticator_Digits(t *testing.T) {
+	_, err := NewAuthenticator(nil, OTPConfig{HashKey: testOption.HashKey, Digits: 10}, "otp:%s")
+	assert.ErrorIs(t, err, ErrOTPDigits)
+	_, err = NewAuthenticator(nil, OTPConfig{HashKey: testOption.HashKey, Digits: 4}, "otp:%s")
+	assert.ErrorIs(t, err, ErrOTPDigits)
+	_, err = NewAuthenticator(nil, OTPConfig{HashKey: testOption.HashKey, Digits: 8}, "otp:%s")
+	assert.NoError(t, err)
+
+	_, err = HOTP(rfcSecret("12345678901234567890"), 0, 10, "")
+	assert.ErrorIs(t, err, ErrOTPDigits)
+}
+
+func TestAuthenticator_URI(t *testing.T) {
+	a := MustNewAuthenticator(nil, OTPConfig{HashKey: testOption.HashKey, Issuer: "Acme Admin"}, "otp:%s")
+	uri := a.URI("alice@example.com", "JBSWY3DPEHPK3PXP")
+
+	u, err := url.Parse(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/Acme Admin:alice@example.com", u.Path)
+	assert.NotContains(t, uri, "+")
+	query := u.Query()
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", query.Get("secret"))
+	assert.Equal(t, "Acme Admin", query.Get("issuer"))
+	assert.Equal(t, "SHA1", query.Get("algorithm"))
+	assert.Equal(t, "6", query.Get("digits"))
+	assert.Equal(t, "30", query.Get("period"))
+
+	u, err = url.Parse(a.HOTPURI("bob", "JBSWY3DPEHPK3PXP", 7))
+	assert.NoError(t, err)
+	assert.Equal(t, "hotp", u.Host)
+	assert.Equal(t, "7", u.Query().Get("counter"))
+}
+
+func TestAuthenticator_RecoveryCodes(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	a := MustNewAuthenticator(rdb, OTPConfig{HashKey: "secret"}, "otp:%s")
+	ctx := context.Background()
+
+	codes, err := a.GenerateRecoveryCodes(ctx, "admin", 0)
+	assert.NoError(t, err)
+	assert.Len(t, codes, defaultRecoveryCodes)
+	assert.Len(t, codes[0], 11)
+
+	members, err := mr.Members("otp:recovery:admin")
+	assert.NoError(t, err)
+	assert.NotContains(t, members, strings.ReplaceAll(codes[0], "-", ""))
+
+	assert.NoError(t, a.UseRecoveryCode(ctx, "admin", strings.ToLower(codes[0])))
+	assert.ErrorIs(t, a.UseRecoveryCode(ctx, "admin", codes[0]), ErrRecoveryCodeInvalid)
+	assert.ErrorIs(t, a.UseRecoveryCode(ctx, "other", codes[1]), ErrRecoveryCodeInvalid)
+
+	remaining, err := a.RemainingRecoveryCodes(ctx, "admin")
+	assert.NoError(t, err)
+	assert.Equal(t, defaultRecoveryCodes-1, remaining)
+
+	// regenerating invalidates the old codes
+	_, err = a.GenerateRecoveryCodes(ctx, "admin", 2)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, a.UseRecoveryCode(ctx, "admin", codes[1]), ErrRecoveryCodeInvalid)
+}
@@ -0,0 +1,98 @@
+package verify_code
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Purpose keeps codes sent for one action from being accepted by another.
+type Purpose string
+
+const (
+	PurposeLogin         Purpose = "login"
+	PurposeBind          Purpose = "bind"
+	PurposeResetPassword Purpose = "reset_password"
+	PurposePayment       Purpose = "payment"
+)
+
+// PurposeOption overrides the limits of VerifyCodeOption for one purpose,
+// zero fields keep the shared value.
+type PurposeOption struct {
+	Interval     int `yaml:"interval"`
+	Limit        int `yaml:"limit"`
+	Lifetime     int `yaml:"lifetime"`
+	ErrorTimes   int `yaml:"error_times"`
+	SuccessTimes int `yaml:"success_times"`
+}
+
+func (opt VerifyCodeOption) forPurpose(purpose Purpose) VerifyCodeOption {
+	override, ok := opt.Purposes[purpose]
+	if !ok {
+		return opt
+	}
+	if override.Interval > 0 {
+		opt.Interval = override.Interval
+	}
+	if override.Limit > 0 {
+		opt.Limit = override.Limit
+	}
+	if override.Lifetime > 0 {
+		opt.Lifetime = override.Lifetime
+	}
+	if override.ErrorTimes > 0 {
+		opt.ErrorTimes = override.ErrorTimes
+	}
+	if override.SuccessTimes > 0 {
+		opt.SuccessTimes = override.SuccessTimes
+	}
+	return opt
+}
+
+// PurposeVerifyCode hands out one VerifyCode per purpose. Each has its own
+// codes, counters and abuse limits.
+type PurposeVerifyCode struct {
+	option     VerifyCodeOption
+	newService func(purpose Purpose, opt VerifyCodeOption) VerifyCode
+
+	mutex    sync.Mutex
+	services map[Purpose]VerifyCode
+}
+
+// NewRedisPurposeVerifyCode scopes template by purpose, "code:%s" becomes
+// "code:login:%s" for PurposeLogin.
+func NewRedisPurposeVerifyCode(rdb redis.UniversalClient, opt VerifyCodeOption, template string, opts ...ServiceOption) *PurposeVerifyCode {
+	return &PurposeVerifyCode{
+		option: opt,
+		newService: func(purpose Purpose, opt VerifyCodeOption) VerifyCode {
+			purposeTemplate := strings.Replace(template, "%s", string(purpose)+":%s", 1)
+			return NewRedisVerifyCodeService(rdb, opt, purposeTemplate, append(opts[:len(opts):len(opts)], withPurpose(purpose))...)
+		},
+		services: make(map[Purpose]VerifyCode),
+	}
+}
+
+func NewMemoryPurposeVerifyCode(opt VerifyCodeOption, opts ...ServiceOption) *PurposeVerifyCode {
+	return &PurposeVerifyCode{
+		option: opt,
+		newService: func(purpose Purpose, opt VerifyCodeOption) VerifyCode {
+			return NewMemoryVerifyCodeService(opt, append(opts[:len(opts):len(opts)], withPurpose(purpose))...)
+		},
+		services: make(map[Purpose]VerifyCode),
+	}
+}
+
+// For returns the VerifyCode of purpose, purposes outside the constants work
+// as well.
+func (p *PurposeVerifyCode) For(purpose Purpose) VerifyCode {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	service, ok := p.services[purpose]
+	if !ok {
+		service = p.newService(purpose, p.option.forPurpose(purpose))
+		p.services[purpose] = service
+	}
+	return service
+}
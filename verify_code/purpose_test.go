@@ -0,0 +1,130 @@
+package verify_code
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestPurposeVerifyCode(t *testing.T) {
+	opt := testOption
+	opt.Purposes = map[Purpose]PurposeOption{
+		PurposePayment: {Lifetime: 60, ErrorTimes: 1},
+	}
+
+	mr, rdb := newTestRedis(t)
+	purposes := map[string]*PurposeVerifyCode{
+		"redis":  NewRedisPurposeVerifyCode(rdb, opt, "code:%s"),
+		"memory": NewMemoryPurposeVerifyCode(opt),
+	}
+	ctx := context.Background()
+
+	for name, p := range purposes {
+		t.Run(name, func(t *testing.T) {
+			login := p.For(PurposeLogin)
+			assert.Same(t, login, p.For(PurposeLogin))
+
+			_, err := login.StoreVerifyCode(ctx, "user1", "111111", "ip")
+			assert.NoError(t, err)
+			// the login code is no use for binding
+			assert.ErrorIs(t, validateErr(p.For(PurposeBind), "user1", "111111", "ip"), RedisValidateVerifyCodeErr)
+			// and the interval of login does not block payment
+			result, err := p.For(PurposePayment).StoreVerifyCode(ctx, "user1", "222222", "ip")
+			assert.NoError(t, err)
+			assert.WithinDuration(t, time.Now().Add(60*time.Second), result.ExpireAt, 2*time.Second)
+
+			validation, err := p.For(PurposePayment).ValidateVerifyCode(ctx, "user1", "000000", "ip")
+			assert.ErrorIs(t, err, RedisValidateVerifyCodeErr)
+			assert.Equal(t, 1, validation.RemainingAttempts)
+			assert.NoError(t, validateErr(login, "user1", "111111", "ip"))
+		})
+	}
+	assert.True(t, mr.Exists("code:login:user1"))
+	assert.True(t, mr.Exists("code:payment:user1"))
+}
+
+func TestPurposeOption_Yaml(t *testing.T) {
+	var opt VerifyCodeOption
+	err := yaml.Unmarshal([]byte(`
+interval: 60
+lifetime: 300
+purposes:
+  payment:
+    lifetime: 60
+`), &opt)
+	assert.NoError(t, err)
+	assert.Equal(t, 60, opt.forPurpose(PurposePayment).Lifetime)
+	assert.Equal(t, 60, opt.forPurpose(PurposePayment).Interval)
+	assert.Equal(t, 300, opt.forPurpose(PurposeLogin).Lifetime)
+}
+
+func TestMagicToken(t *testing.T) {
+	runOnBoth(t, func(t *testing.T, vc VerifyCode) {
+		ctx := context.Background()
+
+		token, result, err := IssueToken(ctx, vc, "a@example.com", "ip")
+		assert.NoError(t, err)
+		assert.Greater(t, len(token), 43)
+		assert.False(t, result.ExpireAt.IsZero())
+		assert.NotContains(t, token, "a@example.com")
+
+		key, _, err := RedeemToken(ctx, vc, token, "ip")
+		assert.NoError(t, err)
+		assert.Equal(t, "a@example.com", key)
+
+		// single use even though SuccessTimes allows more
+		_, _, err = RedeemToken(ctx, vc, token, "ip")
+		assert.Error(t, err)
+
+		_, _, err = RedeemToken(ctx, vc, "garbage", "ip")
+		assert.ErrorIs(t, err, ErrTokenInvalid)
+
+		encodedKey, _, _ := strings.Cut(token, ".")
+		_, _, err = RedeemToken(ctx, vc, encodedKey+".forged", "ip")
+		assert.Error(t, err)
+	})
+}
+
+func TestMagicToken_ConcurrentRedeem(t *testing.T) {
+	opt := testOption
+	opt.SuccessTimes = 5
+	for name, factory := range map[string]serviceFactory{"redis": newRedisFactory, "memory": newMemoryFactory} {
+		t.Run(name, func(t *testing.T) {
+			vc, _ := factory(t, opt)
+			ctx := context.Background()
+			token, _, err := IssueToken(ctx, vc, "a@example.com", "ip")
+			assert.NoError(t, err)
+
+			var redeemed atomic.Int32
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, _, err := RedeemToken(ctx, vc, token, "ip"); err == nil {
+						redeemed.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+			assert.Equal(t, int32(1), redeemed.Load())
+		})
+	}
+}
+
+func runOnBoth(t *testing.T, fn func(t *testing.T, vc VerifyCode)) {
+	t.Run("redis", func(t *testing.T) {
+		vc, _ := newRedisFactory(t, testOption)
+		fn(t, vc)
+	})
+	t.Run("memory", func(t *testing.T) {
+		vc, _ := newMemoryFactory(t, testOption)
+		fn(t, vc)
+	})
+}
@@ -1,5 +1,6 @@
 package verify_code
 
+// returns {err, resend after, remaining sends, time of the current code}
 const redisStoreVerifyCodeScript = `
 		local key =  KEYS[1]
 		local ip = ARGV[1]
@@ -11,18 +12,37 @@ const redisStoreVerifyCodeScript = `
 		local errLimit = tonumber(ARGV[7])
 	
 		local time = tonumber(redis.call('HGET', key, 'time'))
+		local total = tonumber(redis.call('HGET', key, 'total')) or 0
 		if time and now - time < interval then
-			return {errFast,(interval + time - now)}
+			return {errFast,(interval + time - now),math.max(dayTotal - total, 0),time}
 		end
-		local total = tonumber(redis.call('HGET', key, 'total'))
-		if total and total >= dayTotal then
-			return {errLimit,0}
+		if total >= dayTotal then
+			return {errLimit,math.max(redis.call('TTL', key), 0),0,time or 0}
 		end
+
+		-- KEYS[2..] are abuse limit counters, ARGV[8..] is limit, window, err for each
+		for i = 2, #KEYS do
+			local arg = 8 + (i - 2) * 3
+			local count = tonumber(redis.call('GET', KEYS[i]))
+			if count and count >= tonumber(ARGV[arg]) then
+				local ttl = math.max(redis.call('TTL', KEYS[i]), 0)
+				return {tonumber(ARGV[arg + 2]),ttl,dayTotal - total,time or 0}
+			end
+		end
+		for i = 2, #KEYS do
+			local arg = 8 + (i - 2) * 3
+			if redis.call('INCR', KEYS[i]) == 1 then
+				redis.call('EXPIRE', KEYS[i], tonumber(ARGV[arg + 1]))
+			end
+		end
+
 		redis.call('HMSET', key, 'code', code, 'time', now, 'ip', ip, 'success', 0, 'error', 0)
-		redis.call('HINCRBY', key, 'total', 1)
+		total = redis.call('HINCRBY', key, 'total', 1)
 		redis.call('EXPIRE', key, 3600 * 24)
-		return {0,interval}
+		return {0,interval,dayTotal - total,now}
 	`
+
+// returns {err, remaining attempts, time of the current code}
 const redisValidateVerifyCodeScript = `
 		local key =  KEYS[1]
 		local ip = ARGV[1]
@@ -38,34 +58,58 @@ const redisValidateVerifyCodeScript = `
 		local errInvalid = tonumber(ARGV[9])
 
 		local currCode = redis.call('HGET', key, 'code')
+		local time = tonumber(redis.call('HGET', key, 'time'))
 		if type(currCode) == 'string' and string.len(currCode) > 0 then
 			if currCode ~= code then
 				local curErrorTimes = redis.call('HINCRBY', key, 'error', 1)
 				if curErrorTimes > errorTimes then
 					redis.call('HSET', key, 'code', '')
 				end
-				return errInvalid
+				return {errInvalid,math.max(errorTimes + 1 - curErrorTimes, 0),time or 0}
 			end
-			local time = tonumber(redis.call('HGET', key, 'time'))
+			local remaining = errorTimes + 1 - (tonumber(redis.call('HGET', key, 'error')) or 0)
 			if not time or now - time > lifetime then
-				return errExpired
+				return {errExpired,remaining,time or 0}
 			end
 			local curSuccessTimes = redis.call('HINCRBY', key, 'success', 1)
 			if curSuccessTimes > successTimes then
 				redis.call('HSET', key, 'code', '')
 			end
-			return 0
+			return {0,remaining,time}
 		end
 		local retArr = redis.call('HMGET', key, 'success','error')
 		local successTime = tonumber(retArr[1])
 		local errorTimes = tonumber(retArr[2])
 		if ( errorTimes and errorTimes > 0 ) or ( successTime and successTime > 0 ) then
-			return errReset
+			return {errReset,0,0}
 		end    
-		return errInvalid
+		return {errInvalid,0,0}
 	`
 const redisResetVerifyCodeScript = `
 		local key = KEYS[1]
 		local res = redis.call('HSET', key, 'code', '')
 		return res
 	`
+
+// returns 1 if ARGV[1] is later than the last used totp step
+const redisUseTOTPStepScript = `
+		local last = tonumber(redis.call('GET', KEYS[1]))
+		local step = tonumber(ARGV[1])
+		if last and step <= last then
+			return 0
+		end
+		redis.call('SET', KEYS[1], ARGV[1], 'EX', tonumber(ARGV[2]))
+		return 1
+	`
+
+// moves the hotp counter one past ARGV[1] and returns it, or returns minus
+// the counter when it is already past ARGV[1]
+const redisUseHOTPCounterScript = `
+		local counter = tonumber(redis.call('GET', KEYS[1])) or 0
+		local matched = tonumber(ARGV[1])
+		if matched < counter then
+			return -counter
+		end
+		redis.call('SET', KEYS[1], matched + 1)
+		return matched + 1
+	`
@@ -16,6 +16,9 @@ var (
 	redisValidateVerifyCodeErrInvalidCode = 3
 	redisValidateVerifyCodeErrExpiredCode = 4
 	redisNeedResetVerifyCodeErrCode       = 5
+	redisStoreVerifyCodeErrIPLimitCode    = 6
+	redisStoreVerifyCodeErrDeviceCode     = 7
+	redisStoreVerifyCodeErrPrefixCode     = 8
 )
 
 var (
@@ -24,6 +27,9 @@ var (
 	RedisValidateVerifyCodeErr     = errors.New("verify code is invalid")
 	RedisValidateVerifyCodeExpired = errors.New("verify code is expired")
 	RedisNeedResetVerifyCode       = errors.New("verify code need reset")
+	RedisStoreVerifyCodeErrIPLimit = errors.New("verify code is too many for this ip")
+	RedisStoreVerifyCodeErrDevice  = errors.New("verify code is too many for this device")
+	RedisStoreVerifyCodeErrPrefix  = errors.New("verify code is too many for this destination prefix")
 )
 
 var errMap = map[int]error{
@@ -33,65 +39,122 @@ var errMap = map[int]error{
 	redisValidateVerifyCodeErrInvalidCode: RedisValidateVerifyCodeErr,
 	redisValidateVerifyCodeErrExpiredCode: RedisValidateVerifyCodeExpired,
 	redisNeedResetVerifyCodeErrCode:       RedisNeedResetVerifyCode,
+	redisStoreVerifyCodeErrIPLimitCode:    RedisStoreVerifyCodeErrIPLimit,
+	redisStoreVerifyCodeErrDeviceCode:     RedisStoreVerifyCodeErrDevice,
+	redisStoreVerifyCodeErrPrefixCode:     RedisStoreVerifyCodeErrPrefix,
 }
 
 type redisVerifyCodeService struct {
 	option      VerifyCodeOption
 	rdb         redis.UniversalClient
 	keyTemplate string
+	sender      Sender
+	auditor     auditor
+	now         func() time.Time
 }
 
-func (s *redisVerifyCodeService) StoreVerifyCode(ctx context.Context, key, code, ip string) (int, error) {
+func (s *redisVerifyCodeService) StoreVerifyCode(ctx context.Context, key, code, ip string, opts ...RequestOption) (StoreResult, error) {
+	o := newRequestOptions(opts)
+	result, err := s.storeVerifyCode(ctx, key, code, ip, o)
+	s.auditor.emit(ctx, AuditActionStore, key, ip, o.device, err)
+	return result, err
+}
+
+func (s *redisVerifyCodeService) storeVerifyCode(ctx context.Context, key, code, ip string, o requestOptions) (StoreResult, error) {
 	script := redis.NewScript(redisStoreVerifyCodeScript)
 	verifyCodeKey := fmt.Sprintf(s.keyTemplate, key)
-	slice, err := script.Run(
-		ctx,
-		s.rdb,
-		[]string{verifyCodeKey},
+	keys := []string{verifyCodeKey}
+	args := []any{
 		ip,
-		code,
-		time.Now().Unix(),
+		hashCode(s.option.HashKey, key, code),
+		s.now().Unix(),
 		s.option.Interval,
 		s.option.Limit,
 		redisStoreVerifyCodeErrFastCode,
 		redisStoreVerifyCodeErrLimitCode,
-	).Int64Slice()
+	}
+
+	addLimit := func(limit RateLimit, name, value string, errCode int) {
+		if !limit.enabled() || value == "" {
+			return
+		}
+		keys = append(keys, fmt.Sprintf(s.keyTemplate, "limit:"+name+":"+value))
+		args = append(args, limit.Limit, limit.Window, errCode)
+	}
+	addLimit(s.option.IPLimit, "ip", ip, redisStoreVerifyCodeErrIPLimitCode)
+	addLimit(s.option.DeviceLimit, "device", o.device, redisStoreVerifyCodeErrDeviceCode)
+	if o.destination != "" {
+		addLimit(s.option.PrefixLimit, "prefix", destinationPrefix(o.destination, s.option.PrefixLength), redisStoreVerifyCodeErrPrefixCode)
+	}
+
+	slice, err := script.Run(ctx, s.rdb, keys, args...).Int64Slice()
 
 	if err != nil {
-		return 0, err
+		return StoreResult{}, err
 	}
 
 	errCode := int(slice[0])
-	interval := int(slice[1])
+	result := StoreResult{
+		ResendAfter:    int(slice[1]),
+		RemainingSends: int(slice[2]),
+		ExpireAt:       codeExpireAt(slice[3], s.option.Lifetime),
+	}
+
+	return result, errMap[errCode]
+}
 
-	return interval, errMap[errCode]
+func (s *redisVerifyCodeService) ValidateVerifyCode(ctx context.Context, key, code, ip string) (ValidateResult, error) {
+	result, err := s.validateVerifyCode(ctx, key, code, ip, s.option.SuccessTimes)
+	s.auditor.emit(ctx, AuditActionValidate, key, ip, "", err)
+	return result, err
 }
-func (s *redisVerifyCodeService) ValidateVerifyCode(ctx context.Context, key, code, ip string) error {
+
+func (s *redisVerifyCodeService) redeemVerifyCode(ctx context.Context, key, code, ip string) (ValidateResult, error) {
+	result, err := s.validateVerifyCode(ctx, key, code, ip, 0)
+	s.auditor.emit(ctx, AuditActionValidate, key, ip, "", err)
+	return result, err
+}
+
+// validateVerifyCode clears the code once it succeeded more than
+// successTimes times.
+func (s *redisVerifyCodeService) validateVerifyCode(ctx context.Context, key, code, ip string, successTimes int) (ValidateResult, error) {
 	script := redis.NewScript(redisValidateVerifyCodeScript)
 	verifyCodeKey := fmt.Sprintf(s.keyTemplate, key)
-	errCode, err := script.Run(
+	slice, err := script.Run(
 		ctx,
 		s.rdb,
 		[]string{verifyCodeKey},
 		ip,
-		code,
-		time.Now().Unix(),
+		hashCode(s.option.HashKey, key, code),
+		s.now().Unix(),
 		s.option.Lifetime,
 		s.option.ErrorTimes,
-		s.option.SuccessTimes,
+		successTimes,
 		redisNeedResetVerifyCodeErrCode,
 		redisValidateVerifyCodeErrExpiredCode,
 		redisValidateVerifyCodeErrInvalidCode,
-	).Int()
+	).Int64Slice()
 
 	if err != nil {
-		return err
+		return ValidateResult{}, err
+	}
+
+	errCode := int(slice[0])
+	result := ValidateResult{
+		RemainingAttempts: int(slice[1]),
+		ExpireAt:          codeExpireAt(slice[2], s.option.Lifetime),
 	}
 
-	return errMap[errCode]
+	return result, errMap[errCode]
 }
 
 func (s *redisVerifyCodeService) ResetVerifyCode(ctx context.Context, key string) error {
+	err := s.resetVerifyCode(ctx, key)
+	s.auditor.emit(ctx, AuditActionReset, key, "", "", err)
+	return err
+}
+
+func (s *redisVerifyCodeService) resetVerifyCode(ctx context.Context, key string) error {
 	script := redis.NewScript(redisResetVerifyCodeScript)
 	smsVerifyCodeKey := fmt.Sprintf(s.keyTemplate, key)
 	_, err := script.Run(ctx, s.rdb, []string{smsVerifyCodeKey}).Int()
@@ -101,10 +164,23 @@ func (s *redisVerifyCodeService) ResetVerifyCode(ctx context.Context, key string
 	return nil
 }
 
-func NewRedisVerifyCodeService(rdb redis.UniversalClient, opt VerifyCodeOption, template string) VerifyCode {
+func (s *redisVerifyCodeService) sendVerifyCode(ctx context.Context, key, ip string, recipient Recipient, opts []RequestOption) (StoreResult, error) {
+	return deliverVerifyCode(ctx, s, s.sender, s.auditor, s.option, key, ip, recipient, opts)
+}
+
+// NewRedisVerifyCodeService stores codes as a hash under template formatted
+// with the key, e.g. "sms_code:%s".
+func NewRedisVerifyCodeService(rdb redis.UniversalClient, opt VerifyCodeOption, template string, opts ...ServiceOption) VerifyCode {
+	if opt.HashKey == "" {
+		warnEmptyHashKey("NewRedisVerifyCodeService")
+	}
+	o := newServiceOptions(opts)
 	return &redisVerifyCodeService{
 		option:      opt,
 		rdb:         rdb,
 		keyTemplate: template,
+		sender:      o.sender,
+		auditor:     newAuditor(o),
+		now:         o.now,
 	}
 }
@@ -0,0 +1,152 @@
+package verify_code
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/dgdts/ts-gobase/i18n"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+var testOption = VerifyCodeOption{
+	Interval:     60,
+	Limit:        10,
+	Lifetime:     300,
+	ErrorTimes:   3,
+	SuccessTimes: 1,
+	HashKey:      "test-secret",
+}
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, redis.UniversalClient) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return mr, rdb
+}
+
+func TestRedisVerifyCode_StoresHash(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	vc := NewRedisVerifyCodeService(rdb, testOption, "code:%s")
+	ctx := context.Background()
+
+	_, err := vc.StoreVerifyCode(ctx, "user1", "123456", "127.0.0.1")
+	assert.NoError(t, err)
+
+	stored := mr.HGet("code:user1", "code")
+	assert.NotEqual(t, "123456", stored)
+	assert.Equal(t, hashCode(testOption.HashKey, "user1", "123456"), stored)
+
+	assert.ErrorIs(t, validateErr(vc, "user1", "654321", "127.0.0.1"), RedisValidateVerifyCodeErr)
+	assert.NoError(t, validateErr(vc, "user1", "123456", "127.0.0.1"))
+}
+
+func TestRedisVerifyCode_Send(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	sender := NewMemorySender()
+	vc := NewRedisVerifyCodeService(rdb, testOption, "code:%s", WithSender(sender))
+	ctx := context.Background()
+
+	result, err := SendVerifyCode(ctx, vc, "user1", "127.0.0.1", Recipient{To: "+10000000000"})
+	assert.NoError(t, err)
+	assert.Equal(t, testOption.Interval, result.ResendAfter)
+
+	code, ok := sender.LastCode("+10000000000")
+	assert.True(t, ok)
+	assert.Len(t, code, defaultCodeLength)
+	assert.Equal(t, "Your verification code is "+code+", valid for 5 minutes.", sender.Messages()[0].Content)
+	assert.NoError(t, validateErr(vc, "user1", code, "127.0.0.1"))
+
+	_, err = SendVerifyCode(ctx, vc, "user1", "127.0.0.1", Recipient{To: "+10000000000"})
+	assert.ErrorIs(t, err, RedisStoreVerifyCodeErrFast)
+	assert.Len(t, sender.Messages(), 1)
+}
+
+func TestRedisVerifyCode_SendI18n(t *testing.T) {
+	err := i18n.InitAndUpdateI18n(map[string]map[string]string{
+		defaultMessageKey: {
+			"en_US": "Code {{.Code}}",
+			"zh_CN": "验证码 {{.Code}}，{{.Minutes}} 分钟内有效",
+		},
+		defaultSubjectKey: {
+			"en_US": "Your code",
+			"zh_CN": "验证码",
+		},
+	})
+	assert.NoError(t, err)
+
+	_, rdb := newTestRedis(t)
+	sender := NewMemorySender()
+	vc := NewRedisVerifyCodeService(rdb, testOption, "code:%s", WithSender(sender))
+
+	_, err = SendVerifyCode(context.Background(), vc, "user1", "", Recipient{To: "a@example.com", Lang: "zh_CN"})
+	assert.NoError(t, err)
+
+	message := sender.Messages()[0]
+	assert.Equal(t, "验证码 "+message.Code+"，5 分钟内有效", message.Content)
+	assert.Equal(t, "验证码", message.Subject)
+}
+
+func TestRedisVerifyCode_SendFailure(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	var sent string
+	gateway := SMSGatewayFunc(func(ctx context.Context, phone, content string) error {
+		sent = content
+		return errors.New("gateway down")
+	})
+	vc := NewRedisVerifyCodeService(rdb, testOption, "code:%s", WithSender(NewSMSSender(gateway)))
+	ctx := context.Background()
+
+	_, err := SendVerifyCode(ctx, vc, "user1", "", Recipient{To: "+10000000000"})
+	assert.Error(t, err)
+	assert.NotEmpty(t, sent)
+
+	// the undelivered code was reset
+	code := sent[len("Your verification code is ") : len("Your verification code is ")+defaultCodeLength]
+	assert.Error(t, validateErr(vc, "user1", code, ""))
+
+	// the failed send still counts toward Interval
+	_, err = SendVerifyCode(ctx, vc, "user1", "", Recipient{To: "+10000000000"})
+	assert.ErrorIs(t, err, RedisStoreVerifyCodeErrFast)
+}
+
+func TestEmptyHashKeyIsLogged(t *testing.T) {
+	var logs bytes.Buffer
+	hlog.SetOutput(&logs)
+	t.Cleanup(func() { hlog.SetOutput(os.Stderr) })
+
+	_, rdb := newTestRedis(t)
+	NewRedisVerifyCodeService(rdb, testOption, "code:%s")
+	NewMemoryVerifyCodeService(testOption)
+	assert.Empty(t, logs.String())
+
+	noKey := testOption
+	noKey.HashKey = ""
+	NewRedisVerifyCodeService(rdb, noKey, "code:%s")
+	NewMemoryVerifyCodeService(noKey)
+	assert.Equal(t, 2, bytes.Count(logs.Bytes(), []byte("hash_key is empty")))
+}
+
+func TestRedisVerifyCode_NoSender(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	vc := NewRedisVerifyCodeService(rdb, testOption, "code:%s")
+	_, err := SendVerifyCode(context.Background(), vc, "user1", "", Recipient{To: "x"})
+	assert.ErrorIs(t, err, ErrNoSender)
+
+	// implementations outside this package cannot send
+	wrapped := struct{ VerifyCode }{NewRedisVerifyCodeService(rdb, testOption, "code:%s", WithSender(NewMemorySender()))}
+	_, err = SendVerifyCode(context.Background(), wrapped, "user1", "", Recipient{To: "x"})
+	assert.ErrorIs(t, err, ErrNoSender)
+}
+
+func TestDestinationPrefix(t *testing.T) {
+	assert.Equal(t, "+86", destinationPrefix("+8613800000000", 3))
+	assert.Equal(t, "example.com", destinationPrefix("a@Example.com", 3))
+	assert.Equal(t, "+1", destinationPrefix("+1", 3))
+	assert.Equal(t, "+8613800000000", destinationPrefix("+8613800000000", 0))
+}
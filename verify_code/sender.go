@@ -0,0 +1,295 @@
+package verify_code
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/dgdts/ts-gobase/i18n"
+)
+
+const (
+	defaultMessageKey = "verify_code_message"
+	defaultSubjectKey = "verify_code_subject"
+)
+
+// fallbacks when the i18n keys are not configured
+var (
+	defaultMessageTemplate = template.Must(template.New(defaultMessageKey).Parse(
+		"Your verification code is {{.Code}}, valid for {{.Minutes}} minutes."))
+	defaultSubject = "Verification code"
+)
+
+var ErrNoSender = errors.New("verify code sender is not configured")
+
+type Message struct {
+	To      string
+	Subject string // only used by email
+	Content string
+	Code    string
+}
+
+type Sender interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// SMSGateway is implemented by the SMS vendor client.
+type SMSGateway interface {
+	SendSMS(ctx context.Context, phone, content string) error
+}
+
+type SMSGatewayFunc func(ctx context.Context, phone, content string) error
+
+func (f SMSGatewayFunc) SendSMS(ctx context.Context, phone, content string) error {
+	return f(ctx, phone, content)
+}
+
+type smsSender struct {
+	gateway SMSGateway
+}
+
+func NewSMSSender(gateway SMSGateway) Sender {
+	return &smsSender{gateway: gateway}
+}
+
+func (s *smsSender) Send(ctx context.Context, message Message) error {
+	return s.gateway.SendSMS(ctx, message.To, message.Content)
+}
+
+const defaultEmailTimeout = 30 * time.Second
+
+type EmailConfig struct {
+	Host           string `yaml:"host"`
+	Port           int    `yaml:"port"`
+	Username       string `yaml:"username"`
+	Password       string `yaml:"password"`
+	From           string `yaml:"from"`
+	TimeoutSeconds int    `yaml:"timeout_seconds"` // limit of a whole send, default 30
+}
+
+type emailSender struct {
+	config EmailConfig
+}
+
+// NewEmailSender sends plain text mails through SMTP with PLAIN auth, using
+// STARTTLS when the server offers it.
+func NewEmailSender(config EmailConfig) Sender {
+	return &emailSender{config: config}
+}
+
+func (s *emailSender) Send(ctx context.Context, message Message) error {
+	if strings.ContainsAny(message.To, "\r\n") || strings.ContainsAny(message.Subject, "\r\n") {
+		return errors.New("invalid email header")
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\n", s.config.From)
+	fmt.Fprintf(&body, "To: %s\r\n", message.To)
+	fmt.Fprintf(&body, "Subject: %s\r\n", message.Subject)
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	body.WriteString(message.Content)
+
+	timeout := defaultEmailTimeout
+	if s.config.TimeoutSeconds > 0 {
+		timeout = time.Duration(s.config.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	// smtp has no context support, the deadline bounds every read and write
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer client.Close()
+	return s.sendMail(client, message.To, body.Bytes())
+}
+
+// sendMail is smtp.SendMail on an open client.
+func (s *emailSender) sendMail(client *smtp.Client, to string, body []byte) error {
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.config.Host}); err != nil {
+			return err
+		}
+	}
+	if s.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(s.config.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+type logSender struct{}
+
+// NewLogSender only logs the message, for local development.
+func NewLogSender() Sender {
+	return logSender{}
+}
+
+func (logSender) Send(ctx context.Context, message Message) error {
+	hlog.CtxInfof(ctx, "verify code to:%s content:%s", message.To, message.Content)
+	return nil
+}
+
+// MemorySender keeps sent messages for tests.
+type MemorySender struct {
+	mutex    sync.Mutex
+	messages []Message
+}
+
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+func (s *MemorySender) Send(ctx context.Context, message Message) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.messages = append(s.messages, message)
+	return nil
+}
+
+func (s *MemorySender) Messages() []Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// LastCode returns the code of the latest message sent to to.
+func (s *MemorySender) LastCode(to string) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if s.messages[i].To == to {
+			return s.messages[i].Code, true
+		}
+	}
+	return "", false
+}
+
+func renderMessage(opt VerifyCodeOption, recipient Recipient, code string) Message {
+	params := map[string]any{
+		"Code":    code,
+		"Minutes": (opt.Lifetime + 59) / 60,
+	}
+
+	messageKey := opt.MessageKey
+	if messageKey == "" {
+		messageKey = defaultMessageKey
+	}
+	content, err := i18n.GetLocalizeMessage(recipient.Lang, messageKey, params)
+	if err != nil {
+		var buf bytes.Buffer
+		_ = defaultMessageTemplate.Execute(&buf, params)
+		content = buf.String()
+	}
+
+	subjectKey := opt.SubjectKey
+	if subjectKey == "" {
+		subjectKey = defaultSubjectKey
+	}
+	subject, err := i18n.GetLocalizeMessage(recipient.Lang, subjectKey, params)
+	if err != nil {
+		subject = defaultSubject
+	}
+
+	return Message{
+		To:      recipient.To,
+		Subject: subject,
+		Content: content,
+		Code:    code,
+	}
+}
+
+// codeSender is implemented by the services of this package, which know
+// their Sender and message settings.
+type codeSender interface {
+	sendVerifyCode(ctx context.Context, key, ip string, recipient Recipient, opts []RequestOption) (StoreResult, error)
+}
+
+// SendVerifyCode generates a code, stores it in vc like StoreVerifyCode and
+// delivers it through the Sender given WithSender to the service. The
+// destination of the prefix limit defaults to recipient.To. Services not
+// created by this package return ErrNoSender.
+//
+// A failed delivery resets the code but still counts toward Interval and
+// Limit, so a broken gateway is not retried in a tight loop.
+func SendVerifyCode(ctx context.Context, vc VerifyCode, key, ip string, recipient Recipient, opts ...RequestOption) (StoreResult, error) {
+	s, ok := vc.(codeSender)
+	if !ok {
+		return StoreResult{}, ErrNoSender
+	}
+	return s.sendVerifyCode(ctx, key, ip, recipient, opts)
+}
+
+// deliverVerifyCode is SendVerifyCode on top of a VerifyCode implementation.
+func deliverVerifyCode(ctx context.Context, vc VerifyCode, sender Sender, auditor auditor, opt VerifyCodeOption, key, ip string, recipient Recipient, opts []RequestOption) (StoreResult, error) {
+	if sender == nil {
+		return StoreResult{}, ErrNoSender
+	}
+
+	code, err := GenerateCode(opt.CodeLength, opt.CodeType)
+	if err != nil {
+		return StoreResult{}, err
+	}
+
+	opts = append([]RequestOption{WithDestination(recipient.To)}, opts...)
+	result, err := vc.StoreVerifyCode(ctx, key, code, ip, opts...)
+	if err != nil {
+		return result, err
+	}
+
+	err = sender.Send(ctx, renderMessage(opt, recipient, code))
+	auditor.emit(ctx, AuditActionSend, key, ip, newRequestOptions(opts).device, err)
+	if err != nil {
+		// the code never arrived, make sure it cannot be guessed either
+		if resetErr := vc.ResetVerifyCode(ctx, key); resetErr != nil {
+			hlog.CtxWarnf(ctx, "reset verify code %s after send failure failed: %v", key, resetErr)
+		}
+		result.ExpireAt = time.Time{}
+		return result, fmt.Errorf("send verify code failed: %w", err)
+	}
+	return result, nil
+}
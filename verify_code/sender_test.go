@@ -0,0 +1,107 @@
+package verify_code
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serveSMTP answers one session with the minimal replies smtp.Client needs
+// and returns the received DATA.
+func serveSMTP(t *testing.T, l net.Listener) <-chan string {
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				received <- data.String()
+				reply("250 queued")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return received
+}
+
+func listenSMTP(t *testing.T) (net.Listener, EmailConfig) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return l, EmailConfig{Host: host, Port: portNumber, From: "noreply@example.com"}
+}
+
+func TestEmailSender(t *testing.T) {
+	l, config := listenSMTP(t)
+	received := serveSMTP(t, l)
+
+	err := NewEmailSender(config).Send(context.Background(), Message{To: "a@example.com", Subject: "Code", Content: "123456"})
+	assert.NoError(t, err)
+	data := <-received
+	assert.Contains(t, data, "To: a@example.com")
+	assert.Contains(t, data, "123456")
+}
+
+func TestEmailSender_Timeout(t *testing.T) {
+	// the server accepts but never greets
+	l, config := listenSMTP(t)
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	silent := func() {
+		conn, err := l.Accept()
+		if err == nil {
+			<-done
+			_ = conn.Close()
+		}
+	}
+	go silent()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := NewEmailSender(config).Send(ctx, Message{To: "a@example.com", Content: "123456"})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+
+	config.TimeoutSeconds = 1
+	go silent()
+	start = time.Now()
+	err = NewEmailSender(config).Send(context.Background(), Message{To: "a@example.com", Content: "123456"})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
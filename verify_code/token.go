@@ -0,0 +1,68 @@
+package verify_code
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+const magicTokenSize = 32
+
+var ErrTokenInvalid = errors.New("verify token is invalid")
+
+// IssueToken stores a long random single use token for key instead of a
+// short code, for links sent by email. The key travels inside the token so
+// RedeemToken needs nothing else. Limits and expiry are those of vc.
+func IssueToken(ctx context.Context, vc VerifyCode, key, ip string, opts ...RequestOption) (string, StoreResult, error) {
+	secret := make([]byte, magicTokenSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", StoreResult{}, err
+	}
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+
+	result, err := vc.StoreVerifyCode(ctx, key, encodedSecret, ip, opts...)
+	if err != nil {
+		return "", result, err
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(key)) + "." + encodedSecret, result, nil
+}
+
+// redeemer is implemented by the services of this package, which validate
+// and clear a code in one step whatever SuccessTimes allows.
+type redeemer interface {
+	redeemVerifyCode(ctx context.Context, key, code, ip string) (ValidateResult, error)
+}
+
+// RedeemToken validates a token of IssueToken and returns its key. A token
+// works once, even under concurrent redeems. Other implementations of
+// VerifyCode are validated and then reset, which is not atomic.
+func RedeemToken(ctx context.Context, vc VerifyCode, token, ip string) (string, ValidateResult, error) {
+	encodedKey, secret, ok := strings.Cut(token, ".")
+	if !ok || secret == "" {
+		return "", ValidateResult{}, ErrTokenInvalid
+	}
+	rawKey, err := base64.RawURLEncoding.DecodeString(encodedKey)
+	if err != nil || len(rawKey) == 0 {
+		return "", ValidateResult{}, ErrTokenInvalid
+	}
+	key := string(rawKey)
+
+	if r, ok := vc.(redeemer); ok {
+		result, err := r.redeemVerifyCode(ctx, key, secret, ip)
+		if err != nil {
+			return "", result, err
+		}
+		return key, result, nil
+	}
+
+	result, err := vc.ValidateVerifyCode(ctx, key, secret, ip)
+	if err != nil {
+		return "", result, err
+	}
+	if err := vc.ResetVerifyCode(ctx, key); err != nil {
+		return "", result, err
+	}
+	return key, result, nil
+}
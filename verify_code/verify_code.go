@@ -1,6 +1,10 @@
 package verify_code
 
-import "context"
+import (
+	"context"
+	"strings"
+	"time"
+)
 
 type VerifyCodeOption struct {
 	Interval     int `yaml:"interval"`
@@ -8,10 +12,129 @@ type VerifyCodeOption struct {
 	Lifetime     int `yaml:"lifetime"`
 	ErrorTimes   int `yaml:"error_times"`
 	SuccessTimes int `yaml:"success_times"`
+
+	HashKey    string `yaml:"hash_key"`    // secret for the stored code hash, an empty one is logged as an error
+	CodeLength int    `yaml:"code_length"` // length of generated codes, default 6
+	CodeType   string `yaml:"code_type"`   // numeric (default) or alphanumeric
+	MessageKey string `yaml:"message_key"` // i18n key of the message body, default verify_code_message
+	SubjectKey string `yaml:"subject_key"` // i18n key of the email subject, default verify_code_subject
+
+	// Abuse limits on sending, counted across keys. Their counters live next
+	// to the code key, so with Redis Cluster the key template needs a hash
+	// tag, e.g. "{verify_code}:%s".
+	IPLimit      RateLimit `yaml:"ip_limit"`
+	DeviceLimit  RateLimit `yaml:"device_limit"`
+	PrefixLimit  RateLimit `yaml:"prefix_limit"`
+	PrefixLength int       `yaml:"prefix_length"` // leading chars of a phone number used as its prefix, e.g. 3 for "+86"
+
+	Purposes map[Purpose]PurposeOption `yaml:"purposes"` // per purpose limits of PurposeVerifyCode
+}
+
+// RateLimit allows Limit sends every Window seconds, zero Limit disables it.
+type RateLimit struct {
+	Limit  int `yaml:"limit"`
+	Window int `yaml:"window"`
+}
+
+func (l RateLimit) enabled() bool {
+	return l.Limit > 0 && l.Window > 0
+}
+
+// Recipient is where SendVerifyCode delivers the code.
+type Recipient struct {
+	To   string // phone number or email address
+	Lang string // i18n language of the message, e.g. en_US
+}
+
+// StoreResult is returned with and without an error, e.g. ResendAfter tells
+// how long to wait after RedisStoreVerifyCodeErrFast.
+type StoreResult struct {
+	ResendAfter    int       // seconds until the next send is allowed
+	RemainingSends int       // sends left within the day
+	ExpireAt       time.Time // expiry of the current code, zero if there is none
+}
+
+type ValidateResult struct {
+	RemainingAttempts int       // wrong codes left before the code is burned
+	ExpireAt          time.Time // expiry of the current code, zero if there is none
 }
 
 type VerifyCode interface {
-	StoreVerifyCode(ctx context.Context, key, code, ip string) (int, error)
-	ValidateVerifyCode(ctx context.Context, key, code, ip string) error
+	StoreVerifyCode(ctx context.Context, key, code, ip string, opts ...RequestOption) (StoreResult, error)
+	ValidateVerifyCode(ctx context.Context, key, code, ip string) (ValidateResult, error)
 	ResetVerifyCode(ctx context.Context, key string) error
 }
+
+// RequestOption describes the requester of a code for the abuse limits.
+type RequestOption func(*requestOptions)
+
+type requestOptions struct {
+	device      string
+	destination string
+}
+
+// WithDevice sets the device fingerprint counted by DeviceLimit.
+func WithDevice(fingerprint string) RequestOption {
+	return func(o *requestOptions) {
+		o.device = fingerprint
+	}
+}
+
+// WithDestination sets the phone number or email address counted by
+// PrefixLimit.
+func WithDestination(destination string) RequestOption {
+	return func(o *requestOptions) {
+		o.destination = destination
+	}
+}
+
+func newRequestOptions(opts []RequestOption) requestOptions {
+	o := requestOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// destinationPrefix is the domain of an email address or the first
+// prefixLength chars of a phone number.
+func destinationPrefix(destination string, prefixLength int) string {
+	if i := strings.LastIndexByte(destination, '@'); i >= 0 {
+		return strings.ToLower(destination[i+1:])
+	}
+	if prefixLength <= 0 || prefixLength >= len(destination) {
+		return destination
+	}
+	return destination[:prefixLength]
+}
+
+type ServiceOption func(*serviceOptions)
+
+type serviceOptions struct {
+	sender  Sender
+	now     func() time.Time
+	audit   AuditSink
+	purpose Purpose
+}
+
+func WithSender(sender Sender) ServiceOption {
+	return func(o *serviceOptions) {
+		o.sender = sender
+	}
+}
+
+// WithClock replaces time.Now, mainly for tests. Redis still expires keys on
+// its own clock.
+func WithClock(now func() time.Time) ServiceOption {
+	return func(o *serviceOptions) {
+		o.now = now
+	}
+}
+
+func newServiceOptions(opts []ServiceOption) serviceOptions {
+	o := serviceOptions{now: time.Now}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}